@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Provider-neutral phone system model. Every adapter decodes into and
+// encodes from this shape, so conversions never need to know about
+// each other.
+type CanonicalPhoneSystem struct {
+	Users   []CanonicalUser   `json:"users"`
+	Numbers []CanonicalNumber `json:"numbers"`
+}
+
+type CanonicalUser struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	PhoneNumber string `json:"phone_number"`
+	Status      string `json:"status"` // "active", "inactive" or a provider-specific value
+}
+
+type CanonicalNumber struct {
+	ID           string          `json:"id"`
+	Number       string          `json:"phone_number"`
+	Capabilities map[string]bool `json:"capabilities"`
+	Location     string          `json:"location"`
+}
+
+// IsActive reports whether the user should be treated as an active account.
+func (u CanonicalUser) IsActive() bool {
+	return u.Status == "active"
+}
+
+// PhoneSystemAdapter converts one platform's export format to and from the
+// canonical model.
+type PhoneSystemAdapter interface {
+	Name() string
+	Decode(data []byte) (*CanonicalPhoneSystem, error)
+	Encode(system *CanonicalPhoneSystem) ([]byte, error)
+}
+
+// Adapter registry, kept in registration order so the TUI lists are stable
+var (
+	adapters     = map[string]PhoneSystemAdapter{}
+	adapterNames []string
+)
+
+func RegisterAdapter(adapter PhoneSystemAdapter) {
+	if _, exists := adapters[adapter.Name()]; !exists {
+		adapterNames = append(adapterNames, adapter.Name())
+	}
+	adapters[adapter.Name()] = adapter
+}
+
+func GetAdapter(name string) (PhoneSystemAdapter, error) {
+	if adapter, ok := adapters[name]; ok {
+		return adapter, nil
+	}
+	for _, registered := range adapterNames {
+		if strings.EqualFold(registered, name) {
+			return adapters[registered], nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported phone system format: %s", name)
+}
+
+// AdapterNames returns the registered format names in registration order.
+func AdapterNames() []string {
+	names := make([]string, len(adapterNames))
+	copy(names, adapterNames)
+	return names
+}
+
+// FormatDetector is implemented by adapters that can recognise their own
+// export format.
+type FormatDetector interface {
+	Detect(data []byte) bool
+}
+
+// DetectFormat names the one registered format that recognises data.
+func DetectFormat(data []byte) (string, error) {
+	var matches []string
+	for _, name := range adapterNames {
+		if detector, ok := adapters[name].(FormatDetector); ok && detector.Detect(data) {
+			matches = append(matches, name)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no known format recognises this file")
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("file matches several formats: %s", strings.Join(matches, ", "))
+}
+
+// hasTopLevelKey reports whether data is a JSON object with any of keys.
+func hasTopLevelKey(data []byte, keys ...string) bool {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return false
+	}
+	for _, key := range keys {
+		if _, ok := object[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// convertBetween decodes data with the source adapter and re-encodes it with
+// the target adapter.
+func convertBetween(sourceFormat, targetFormat string, data []byte) ([]byte, error) {
+	source, err := GetAdapter(sourceFormat)
+	if err != nil {
+		return nil, err
+	}
+	target, err := GetAdapter(targetFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	system, err := source.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s data: %w", sourceFormat, err)
+	}
+
+	return target.Encode(system)
+}
+
+func init() {
+	RegisterAdapter(TwilioAdapter{})
+	RegisterAdapter(RingCentralAdapter{})
+}
+
+// Twilio adapter
+type TwilioAdapter struct{}
+
+func (TwilioAdapter) Name() string { return "Twilio" }
+
+// Detect recognises the users and phone_numbers lists of a Twilio export.
+func (TwilioAdapter) Detect(data []byte) bool {
+	return hasTopLevelKey(data, "users", "phone_numbers")
+}
+
+func (a TwilioAdapter) Decode(data []byte) (*CanonicalPhoneSystem, error) {
+	var twilioSystem TwilioPhoneSystem
+	if err := json.Unmarshal(data, &twilioSystem); err != nil {
+		return nil, err
+	}
+	return a.ToCanonical(twilioSystem), nil
+}
+
+func (a TwilioAdapter) Encode(system *CanonicalPhoneSystem) ([]byte, error) {
+	return json.MarshalIndent(a.FromCanonical(system), "", "  ")
+}
+
+func (TwilioAdapter) ToCanonical(twilioSystem TwilioPhoneSystem) *CanonicalPhoneSystem {
+	system := &CanonicalPhoneSystem{}
+
+	for _, user := range twilioSystem.Users {
+		system.Users = append(system.Users, CanonicalUser{
+			ID:          user.ID,
+			Name:        user.Name,
+			Email:       user.Email,
+			PhoneNumber: user.PhoneNumber,
+			Status:      user.Status,
+		})
+	}
+
+	for _, line := range twilioSystem.Lines {
+		capabilities := make(map[string]bool, len(line.Capabilities))
+		for capability, enabled := range line.Capabilities {
+			capabilities[canonicalCapability("Twilio", capability)] = enabled
+		}
+		system.Numbers = append(system.Numbers, CanonicalNumber{
+			ID:           line.SID,
+			Number:       line.Number,
+			Capabilities: capabilities,
+			Location:     line.Location,
+		})
+	}
+
+	return system
+}
+
+func (TwilioAdapter) UserFromCanonical(user CanonicalUser) TwilioUser {
+	return TwilioUser{
+		ID:          user.ID,
+		Name:        user.Name,
+		Email:       user.Email,
+		PhoneNumber: user.PhoneNumber,
+		Status:      user.Status,
+	}
+}
+
+func (a TwilioAdapter) FromCanonical(system *CanonicalPhoneSystem) TwilioPhoneSystem {
+	var twilioSystem TwilioPhoneSystem
+
+	for _, user := range system.Users {
+		twilioSystem.Users = append(twilioSystem.Users, a.UserFromCanonical(user))
+	}
+
+	for _, number := range system.Numbers {
+		// Capabilities Twilio has no equivalent for are dropped, see unmappedCapabilities
+		capabilities := make(map[string]bool, len(number.Capabilities))
+		for capability, enabled := range number.Capabilities {
+			if name, ok := platformCapability("Twilio", capability); ok {
+				capabilities[name] = enabled
+			}
+		}
+		twilioSystem.Lines = append(twilioSystem.Lines, TwilioLine{
+			SID:          number.ID,
+			Number:       number.Number,
+			Capabilities: capabilities,
+			Location:     number.Location,
+		})
+	}
+
+	return twilioSystem
+}
+
+// RingCentral adapter
+type RingCentralAdapter struct{}
+
+func (RingCentralAdapter) Name() string { return "RingCentral" }
+
+// Detect recognises the accounts and numbers lists of a RingCentral export.
+func (RingCentralAdapter) Detect(data []byte) bool {
+	return hasTopLevelKey(data, "accounts", "numbers")
+}
+
+func (a RingCentralAdapter) Decode(data []byte) (*CanonicalPhoneSystem, error) {
+	var rcSystem RingCentralPhoneSystem
+	if err := json.Unmarshal(data, &rcSystem); err != nil {
+		return nil, err
+	}
+	return a.ToCanonical(rcSystem), nil
+}
+
+func (a RingCentralAdapter) Encode(system *CanonicalPhoneSystem) ([]byte, error) {
+	return json.MarshalIndent(a.FromCanonical(system), "", "  ")
+}
+
+func (RingCentralAdapter) ToCanonical(rcSystem RingCentralPhoneSystem) *CanonicalPhoneSystem {
+	system := &CanonicalPhoneSystem{}
+
+	for _, account := range rcSystem.Accounts {
+		status := "inactive"
+		if account.Active {
+			status = "active"
+		}
+		system.Users = append(system.Users, CanonicalUser{
+			ID:          account.ID,
+			Name:        account.Username,
+			Email:       account.Contact,
+			PhoneNumber: account.MainNumber,
+			Status:      status,
+		})
+	}
+
+	for _, number := range rcSystem.Numbers {
+		// A feature list implies every other feature RingCentral knows is
+		// disabled, which keeps explicit false capabilities through a round trip
+		capabilities := make(map[string]bool)
+		for _, capability := range knownCapabilities("RingCentral") {
+			capabilities[capability] = false
+		}
+		for _, feature := range number.Features {
+			capabilities[canonicalCapability("RingCentral", feature)] = true
+		}
+		system.Numbers = append(system.Numbers, CanonicalNumber{
+			ID:           number.ID,
+			Number:       number.Number,
+			Capabilities: capabilities,
+			Location:     number.Region,
+		})
+	}
+
+	return system
+}
+
+func (RingCentralAdapter) FromCanonical(system *CanonicalPhoneSystem) RingCentralPhoneSystem {
+	var rcSystem RingCentralPhoneSystem
+
+	for _, user := range system.Users {
+		rcSystem.Accounts = append(rcSystem.Accounts, RingCentralAccount{
+			ID:         user.ID,
+			Username:   user.Name,
+			Contact:    user.Email,
+			MainNumber: user.PhoneNumber,
+			Active:     user.IsActive(),
+		})
+	}
+
+	for _, number := range system.Numbers {
+		var features []string
+		for _, capability := range enabledCapabilities(number) {
+			if name, ok := platformCapability("RingCentral", capability); ok {
+				features = append(features, name)
+			}
+		}
+		sort.Strings(features)
+
+		rcSystem.Numbers = append(rcSystem.Numbers, RingCentralNumber{
+			ID:       number.ID,
+			Number:   number.Number,
+			Features: features,
+			Region:   number.Location,
+		})
+	}
+
+	return rcSystem
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAdapterDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   string
+		want   *CanonicalPhoneSystem
+	}{
+		{
+			name:   "twilio",
+			format: "Twilio",
+			data: `{
+				"users": [{"account_sid": "AC1", "friendly_name": "John Doe", "email": "john@example.com", "phone_number": "+15551234567", "status": "suspended"}],
+				"phone_numbers": [{"sid": "PN1", "phone_number": "+15551234567", "capabilities": {"voice": true, "sms": false}, "address_sid": "AD1"}]
+			}`,
+			want: &CanonicalPhoneSystem{
+				Users:   []CanonicalUser{{ID: "AC1", Name: "John Doe", Email: "john@example.com", PhoneNumber: "+15551234567", Status: "suspended"}},
+				Numbers: []CanonicalNumber{{ID: "PN1", Number: "+15551234567", Capabilities: map[string]bool{"voice": true, "sms": false}, Location: "AD1"}},
+			},
+		},
+		{
+			name:   "ringcentral fills in disabled features",
+			format: "RingCentral",
+			data: `{
+				"accounts": [{"id": "1", "name": "Jane Smith", "contact": "jane@example.com", "main_number": "+15559876543", "active": false}],
+				"numbers": [{"id": "N1", "phone_number": "+15559876543", "features": ["voice", "voicemail"], "region": "US-West"}]
+			}`,
+			want: &CanonicalPhoneSystem{
+				Users: []CanonicalUser{{ID: "1", Name: "Jane Smith", Email: "jane@example.com", PhoneNumber: "+15559876543", Status: "inactive"}},
+				Numbers: []CanonicalNumber{{ID: "N1", Number: "+15559876543", Capabilities: map[string]bool{
+					"voice": true, "sms": false, "mms": false, "fax": false, "conferencing": false, "voicemail": true,
+				}, Location: "US-West"}},
+			},
+		},
+		{
+			name:   "empty export",
+			format: "Twilio",
+			data:   `{}`,
+			want:   &CanonicalPhoneSystem{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter, err := GetAdapter(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := adapter.Decode([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdapterDecodeInvalidJSON(t *testing.T) {
+	for _, name := range AdapterNames() {
+		adapter, _ := GetAdapter(name)
+		if _, err := adapter.Decode([]byte(`{"users": [`)); err == nil {
+			t.Errorf("%s: Decode of truncated JSON succeeded", name)
+		}
+	}
+}
+
+func TestAdapterEncodeDecode(t *testing.T) {
+	system := &CanonicalPhoneSystem{
+		Users: []CanonicalUser{
+			{ID: "1", Name: "John Doe", Email: "john@example.com", PhoneNumber: "+15551234567", Status: "active"},
+			{ID: "2", Name: "Jane Smith", Email: "jane@example.com", PhoneNumber: "+15559876543", Status: "inactive"},
+		},
+		Numbers: []CanonicalNumber{
+			{ID: "N1", Number: "+15551234567", Capabilities: map[string]bool{
+				"voice": true, "sms": true, "mms": false, "fax": false, "conferencing": false, "voicemail": false,
+			}, Location: "US-East"},
+		},
+	}
+
+	for _, name := range AdapterNames() {
+		t.Run(name, func(t *testing.T) {
+			adapter, _ := GetAdapter(name)
+			data, err := adapter.Encode(system)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			got, err := adapter.Decode(data)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+
+			want := *system
+			if name == "Twilio" {
+				// Twilio has no conferencing or voicemail
+				want.Numbers = []CanonicalNumber{system.Numbers[0]}
+				want.Numbers[0].Capabilities = map[string]bool{"voice": true, "sms": true, "mms": false, "fax": false}
+			}
+			if !reflect.DeepEqual(got, &want) {
+				t.Errorf("Decode(Encode()) = %+v, want %+v", got, &want)
+			}
+		})
+	}
+}
+
+func TestConvertBetween(t *testing.T) {
+	data := []byte(`{"users": [{"account_sid": "AC1", "friendly_name": "John Doe", "status": "active"}],
+		"phone_numbers": [{"sid": "PN1", "phone_number": "+15551234567", "capabilities": {"voice": true, "sms": true, "mms": false}}]}`)
+
+	converted, err := convertBetween("Twilio", "RingCentral", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	system, err := RingCentralAdapter{}.Decode(converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(system.Users) != 1 || !system.Users[0].IsActive() || system.Users[0].Name != "John Doe" {
+		t.Errorf("users = %+v", system.Users)
+	}
+	if got := enabledCapabilities(system.Numbers[0]); !reflect.DeepEqual(got, []string{"sms", "voice"}) {
+		t.Errorf("enabled capabilities = %v, want [sms voice]", got)
+	}
+
+	if _, err := convertBetween("Twilio", "Teams", data); err == nil {
+		t.Error("conversion to an unknown format succeeded")
+	}
+}
+
+func TestGetAdapter(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"Twilio", "Twilio", false},
+		{"ringcentral", "RingCentral", false},
+		{"Teams", "", true},
+	}
+	for _, tt := range tests {
+		adapter, err := GetAdapter(tt.name)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("GetAdapter(%q) succeeded", tt.name)
+			}
+			continue
+		}
+		if err != nil || adapter.Name() != tt.want {
+			t.Errorf("GetAdapter(%q) = %v, %v, want %s", tt.name, adapter, err, tt.want)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{"twilio", `{"users": [], "phone_numbers": []}`, "Twilio", false},
+		{"twilio numbers only", `{"phone_numbers": []}`, "Twilio", false},
+		{"ringcentral", `{"accounts": [], "numbers": []}`, "RingCentral", false},
+		{"both", `{"users": [], "accounts": []}`, "", true},
+		{"neither", `{"converted_data": {}}`, "", true},
+		{"not an object", `[{"users": []}]`, "", true},
+		{"invalid JSON", `{"users": `, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectFormat([]byte(tt.data))
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("DetectFormat = %q, %v, want %q (error %t)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
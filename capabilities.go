@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// CapabilityMapping names one canonical capability on each platform. A
+// platform missing from Names has no equivalent feature.
+type CapabilityMapping struct {
+	Canonical string            `json:"canonical"`
+	Names     map[string]string `json:"names"`
+}
+
+// A capability that was enabled in the source but has no equivalent in the
+// target format and was dropped
+type UnmappedCapability struct {
+	NumberID     string `json:"number_id"`
+	Capability   string `json:"capability"`
+	TargetFormat string `json:"target_format"`
+}
+
+var defaultCapabilityMappings = []CapabilityMapping{
+	{Canonical: "voice", Names: map[string]string{"Twilio": "voice", "RingCentral": "voice"}},
+	{Canonical: "sms", Names: map[string]string{"Twilio": "sms", "RingCentral": "sms"}},
+	{Canonical: "mms", Names: map[string]string{"Twilio": "mms", "RingCentral": "mms"}},
+	{Canonical: "fax", Names: map[string]string{"Twilio": "fax", "RingCentral": "fax"}},
+	{Canonical: "conferencing", Names: map[string]string{"RingCentral": "conferencing"}},
+	{Canonical: "voicemail", Names: map[string]string{"RingCentral": "voicemail"}},
+}
+
+// Mapping table used by the adapters, replaced by LoadCapabilityMappings
+var capabilityMappings = defaultCapabilityMappings
+
+// Environment variable pointing at a JSON capability mapping file
+const capabilityMapEnv = "CAPABILITY_MAP_FILE"
+
+// LoadCapabilityMappings replaces the mapping table with the JSON array of
+// CapabilityMapping entries in path.
+func LoadCapabilityMappings(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read capability map: %w", err)
+	}
+
+	var mappings []CapabilityMapping
+	if err := json.Unmarshal(data, &mappings); err != nil {
+		return fmt.Errorf("failed to parse capability map: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, mapping := range mappings {
+		if mapping.Canonical == "" {
+			return fmt.Errorf("capability map entry has no canonical name")
+		}
+		if seen[mapping.Canonical] {
+			return fmt.Errorf("capability map lists %q more than once", mapping.Canonical)
+		}
+		seen[mapping.Canonical] = true
+	}
+
+	capabilityMappings = mappings
+	return nil
+}
+
+func loadCapabilityMappingsFromEnv() error {
+	if path := os.Getenv(capabilityMapEnv); path != "" {
+		return LoadCapabilityMappings(path)
+	}
+	return nil
+}
+
+// canonicalCapability translates a platform feature name to its canonical
+// name. Unknown names are kept as-is so they can be reported later.
+func canonicalCapability(format, name string) string {
+	for _, mapping := range capabilityMappings {
+		if mapping.Names[format] == name {
+			return mapping.Canonical
+		}
+	}
+	return name
+}
+
+// platformCapability translates a canonical capability to the platform's
+// feature name, reporting false when the platform has no equivalent.
+func platformCapability(format, canonical string) (string, bool) {
+	for _, mapping := range capabilityMappings {
+		if mapping.Canonical == canonical {
+			name, ok := mapping.Names[format]
+			return name, ok && name != ""
+		}
+	}
+	return "", false
+}
+
+// knownCapabilities lists the canonical capabilities the platform can express.
+func knownCapabilities(format string) []string {
+	var known []string
+	for _, mapping := range capabilityMappings {
+		if mapping.Names[format] != "" {
+			known = append(known, mapping.Canonical)
+		}
+	}
+	return known
+}
+
+// targetCapabilitiesNote tells Engine Room AI which capabilities survive the
+// move to the target format.
+func targetCapabilitiesNote(targetFormat string) string {
+	return fmt.Sprintf("The target system (%s) supports these capabilities: %s. Any other enabled capability is lost when the number is ported; list those in \"capabilities_at_risk\".",
+		targetFormat, strings.Join(knownCapabilities(targetFormat), ", "))
+}
+
+// unmappedCapabilities reports every enabled capability that would be dropped
+// when encoding system into the target format.
+func unmappedCapabilities(system *CanonicalPhoneSystem, targetFormat string) []UnmappedCapability {
+	unmapped := []UnmappedCapability{}
+	for _, number := range system.Numbers {
+		for _, capability := range enabledCapabilities(number) {
+			if _, ok := platformCapability(targetFormat, capability); !ok {
+				unmapped = append(unmapped, UnmappedCapability{
+					NumberID:     number.ID,
+					Capability:   capability,
+					TargetFormat: targetFormat,
+				})
+			}
+		}
+	}
+	sort.SliceStable(unmapped, func(i, j int) bool {
+		return unmapped[i].NumberID < unmapped[j].NumberID
+	})
+	return unmapped
+}
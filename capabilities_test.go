@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUnmappedCapabilities(t *testing.T) {
+	system := &CanonicalPhoneSystem{Numbers: []CanonicalNumber{
+		{ID: "n2", Capabilities: map[string]bool{"voice": true, "voicemail": true, "conferencing": false}},
+		{ID: "n1", Capabilities: map[string]bool{"conferencing": true, "sms": true}},
+	}}
+
+	got := unmappedCapabilities(system, "Twilio")
+	want := []UnmappedCapability{
+		{NumberID: "n1", Capability: "conferencing", TargetFormat: "Twilio"},
+		{NumberID: "n2", Capability: "voicemail", TargetFormat: "Twilio"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unmappedCapabilities = %+v, want %+v", got, want)
+	}
+	if got := unmappedCapabilities(system, "RingCentral"); len(got) != 0 {
+		t.Errorf("RingCentral drops %+v", got)
+	}
+}
+
+func TestLoadCapabilityMappings(t *testing.T) {
+	defer func() { capabilityMappings = defaultCapabilityMappings }()
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	for name, data := range map[string]string{
+		"unnamed.json":   `[{"names": {"Twilio": "voice"}}]`,
+		"duplicate.json": `[{"canonical": "voice"}, {"canonical": "voice"}]`,
+		"invalid.json":   `{"canonical": "voice"}`,
+	} {
+		if err := LoadCapabilityMappings(write(name, data)); err == nil {
+			t.Errorf("%s loaded", name)
+		}
+	}
+	if !reflect.DeepEqual(capabilityMappings, defaultCapabilityMappings) {
+		t.Fatal("a rejected map replaced the mapping table")
+	}
+
+	path := write("custom.json", `[
+		{"canonical": "voice", "names": {"Twilio": "voice", "RingCentral": "Voice"}},
+		{"canonical": "voicemail", "names": {"Twilio": "recording", "RingCentral": "VoiceMail"}}
+	]`)
+	if err := LoadCapabilityMappings(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := canonicalCapability("RingCentral", "VoiceMail"); got != "voicemail" {
+		t.Errorf("canonicalCapability = %q, want voicemail", got)
+	}
+	if got, ok := platformCapability("Twilio", "voicemail"); !ok || got != "recording" {
+		t.Errorf("platformCapability = %q, %t, want recording", got, ok)
+	}
+	if _, ok := platformCapability("Twilio", "sms"); ok {
+		t.Error("sms is still mapped after loading a map without it")
+	}
+	if got := knownCapabilities("RingCentral"); !reflect.DeepEqual(got, []string{"voice", "voicemail"}) {
+		t.Errorf("knownCapabilities = %v", got)
+	}
+}
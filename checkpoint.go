@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Default state file, rewritten after every step of a step-by-step migration
+const defaultCheckpointFile = "migration-state.json"
+
+// Checkpoint is everything needed to continue an interrupted step-by-step
+// migration without asking Engine Room AI again.
+type Checkpoint struct {
+	SavedAt     string           `json:"saved_at"`
+	Config      CheckpointConfig `json:"config"`
+	Plan        *MigrationPlan   `json:"plan"`
+	CurrentStep int              `json:"current_step"`
+	Steps       []CheckpointStep `json:"steps"`
+	Artifacts   RunArtifacts     `json:"artifacts"`
+}
+
+// CheckpointConfig is the migration configuration without the Engine Room
+// AI settings, which hold the API key and are read from the environment
+// again on resume.
+type CheckpointConfig struct {
+	SourceFile      string `json:"source_file"`
+	TargetFile      string `json:"target_file"`
+	SourceFormat    string `json:"source_format"`
+	TargetFormat    string `json:"target_format"`
+	UseAI           bool   `json:"use_ai"`
+	OfflinePlan     bool   `json:"offline_plan"`
+	ApproveHighRisk bool   `json:"approve_high_risk"`
+}
+
+type CheckpointStep struct {
+	StepNumber    int    `json:"step"`
+	Description   string `json:"description"`
+	Action        string `json:"action"`
+	Executor      string `json:"executor"`
+	Risk          string `json:"risk,omitempty"`
+	Status        string `json:"status"`
+	Details       string `json:"details,omitempty"`
+	Error         string `json:"error,omitempty"`
+	Approved      bool   `json:"approved,omitempty"`
+	Justification string `json:"justification,omitempty"`
+}
+
+// RunArtifacts are the results of the steps run so far. The source data is
+// read again on resume and must still match SourceSHA256.
+type RunArtifacts struct {
+	SourceSHA256 string                `json:"source_sha256"`
+	BackupFile   string                `json:"backup_file,omitempty"`
+	Ordered      []CanonicalUser       `json:"ordered"`
+	Converted    *CanonicalPhoneSystem `json:"converted"`
+	Validation   *ValidationReport     `json:"validation,omitempty"`
+	RoundTrip    *RoundTripReport      `json:"round_trip,omitempty"`
+	Written      []writtenFile         `json:"written,omitempty"`
+	Skipped      []SkippedStep         `json:"skipped,omitempty"`
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkpoint captures the run as it stands.
+func (m model) checkpoint() (*Checkpoint, error) {
+	run := m.run
+	sourceData := run.sourceData
+	if sourceData == nil {
+		var err error
+		if sourceData, err = ioutil.ReadFile(run.config.SourceFile); err != nil {
+			return nil, fmt.Errorf("failed to read source file: %w", err)
+		}
+	}
+
+	checkpoint := &Checkpoint{
+		SavedAt: time.Now().Format(time.RFC3339),
+		Config: CheckpointConfig{
+			SourceFile:      m.config.SourceFile,
+			TargetFile:      m.config.TargetFile,
+			SourceFormat:    m.config.SourceFormat,
+			TargetFormat:    m.config.TargetFormat,
+			UseAI:           m.config.UseAI,
+			OfflinePlan:     m.config.OfflinePlan,
+			ApproveHighRisk: m.config.ApproveHighRisk,
+		},
+		Plan:        m.migrationPlan,
+		CurrentStep: m.currentStep,
+		Artifacts: RunArtifacts{
+			SourceSHA256: sha256Hex(sourceData),
+			BackupFile:   run.backupFile,
+			Ordered:      run.ordered,
+			Converted:    run.converted,
+			Validation:   run.validation,
+			RoundTrip:    run.roundTrip,
+			Written:      run.written,
+			Skipped:      run.skipped,
+		},
+	}
+	for _, step := range m.executionSteps {
+		checkpoint.Steps = append(checkpoint.Steps, CheckpointStep{
+			StepNumber:    step.StepNumber,
+			Description:   step.Description,
+			Action:        step.Action,
+			Executor:      step.Executor,
+			Risk:          step.Risk,
+			Status:        step.Status,
+			Details:       step.Details,
+			Error:         errorText(step.Error),
+			Approved:      step.Approved,
+			Justification: step.Justification,
+		})
+	}
+	return checkpoint, nil
+}
+
+// saveCheckpoint replaces the state file. A failure is shown but does not
+// stop the migration.
+func (m model) saveCheckpoint() model {
+	checkpoint, err := m.checkpoint()
+	if err == nil {
+		err = replaceJSONFile(m.checkpointFile, checkpoint)
+	}
+	m.checkpointErr = err
+	return m
+}
+
+// replaceJSONFile writes value to a temporary file beside path and renames it
+// over path, so a run killed mid-write leaves the previous file intact.
+func replaceJSONFile(path string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", path, err)
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// removeCheckpoint deletes the state file once there is nothing to resume.
+func (m model) removeCheckpoint() model {
+	if err := os.Remove(m.checkpointFile); err != nil && !os.IsNotExist(err) {
+		m.checkpointErr = err
+	}
+	return m
+}
+
+// LoadCheckpoint reads a state file written by saveCheckpoint.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if checkpoint.Plan == nil || len(checkpoint.Steps) == 0 {
+		return nil, fmt.Errorf("state file %s has no plan to resume", path)
+	}
+	if checkpoint.CurrentStep < 0 || checkpoint.CurrentStep > len(checkpoint.Steps) {
+		return nil, fmt.Errorf("state file %s is at step %d of %d", path, checkpoint.CurrentStep, len(checkpoint.Steps))
+	}
+	return &checkpoint, nil
+}
+
+// resumedModel rebuilds the executing screen from a checkpoint. The source
+// file must not have changed since the checkpoint was saved.
+func resumedModel(path string) (model, error) {
+	checkpoint, err := LoadCheckpoint(path)
+	if err != nil {
+		return model{}, err
+	}
+
+	m := initialModel()
+	m.config.SourceFile = checkpoint.Config.SourceFile
+	m.config.TargetFile = checkpoint.Config.TargetFile
+	m.config.SourceFormat = checkpoint.Config.SourceFormat
+	m.config.TargetFormat = checkpoint.Config.TargetFormat
+	m.config.UseAI = checkpoint.Config.UseAI
+	m.config.OfflinePlan = checkpoint.Config.OfflinePlan
+	m.config.ApproveHighRisk = checkpoint.Config.ApproveHighRisk
+
+	sourceData, err := ioutil.ReadFile(m.config.SourceFile)
+	if err != nil {
+		return model{}, fmt.Errorf("failed to read source file: %w", err)
+	}
+	if sha256Hex(sourceData) != checkpoint.Artifacts.SourceSHA256 {
+		return model{}, fmt.Errorf("%s has changed since the checkpoint was saved", m.config.SourceFile)
+	}
+	m.run = newMigrationRun(m.config, checkpoint.Plan)
+	if err := m.run.loadSource(); err != nil {
+		return model{}, err
+	}
+	artifacts := checkpoint.Artifacts
+	m.run.backupFile = artifacts.BackupFile
+	m.run.ordered = artifacts.Ordered
+	if artifacts.Converted != nil {
+		m.run.converted = artifacts.Converted
+	}
+	m.run.validation = artifacts.Validation
+	m.run.roundTrip = artifacts.RoundTrip
+	m.run.written = artifacts.Written
+	m.run.skipped = artifacts.Skipped
+
+	for _, step := range checkpoint.Steps {
+		executionStep := ExecutionStep{
+			StepNumber:    step.StepNumber,
+			Description:   step.Description,
+			Action:        step.Action,
+			Executor:      step.Executor,
+			Risk:          step.Risk,
+			Status:        step.Status,
+			Details:       step.Details,
+			Approved:      step.Approved,
+			Justification: step.Justification,
+		}
+		if step.Error != "" {
+			executionStep.Error = errors.New(step.Error)
+		}
+		m.executionSteps = append(m.executionSteps, executionStep)
+	}
+
+	m.migrationPlan = checkpoint.Plan
+	m.currentStep = checkpoint.CurrentStep
+	m.userApproved = true
+	m.checkpointFile = path
+	m.resumedFrom = checkpoint.SavedAt
+	m.state = executingPlan
+	return m, nil
+}
+
+// Sent once on start when resuming, to carry on with the current step
+type resumeMsg struct{}
+
+// resumeRun continues where the checkpoint left off. A failed step stays
+// failed until the user retries, skips or aborts it; a step that was
+// running or waiting starts over.
+func (m model) resumeRun() (model, tea.Cmd) {
+	if m.currentStep < len(m.executionSteps) {
+		step := &m.executionSteps[m.currentStep]
+		if step.Status == "failed" {
+			return m, nil
+		}
+		step.Status = "pending"
+	}
+	return m.startCurrentStep()
+}
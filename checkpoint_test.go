@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// checkpointedModel is a run of a two-step plan with the first step done.
+func checkpointedModel(t *testing.T) model {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "twilio.json")
+	data, err := ioutil.ReadFile("twilio-sample.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(source, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := initialModel()
+	m.config.SourceFile = source
+	m.config.TargetFile = filepath.Join(dir, "ringcentral.json")
+	m.config.SourceFormat = "Twilio"
+	m.config.TargetFormat = "RingCentral"
+	m.config.ApproveHighRisk = true
+	m.config.LLM.APIKey = "secret"
+	m.checkpointFile = filepath.Join(dir, "state.json")
+	m.migrationPlan = &MigrationPlan{TodoList: []TodoItem{
+		{Step: 1, Description: "Validate", Executor: executorValidate},
+		{Step: 2, Description: "Write", Executor: executorWrite, Risk: "high"},
+	}}
+	m.run = newMigrationRun(m.config, m.migrationPlan)
+	m = m.initializeExecutionSteps()
+	if _, err := validateStep(m.run, TodoItem{}); err != nil {
+		t.Fatal(err)
+	}
+	m.executionSteps[0].Status = "completed"
+	m.executionSteps[0].Details = "✓ Validated"
+	m.executionSteps[1].Status = "failed"
+	m.executionSteps[1].Error = errors.New("disk full")
+	m.currentStep = 1
+	return m
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	m := checkpointedModel(t).saveCheckpoint()
+	if m.checkpointErr != nil {
+		t.Fatal(m.checkpointErr)
+	}
+	if files, _ := filepath.Glob(m.checkpointFile + ".tmp-*"); len(files) > 0 {
+		t.Errorf("temporary files left behind: %v", files)
+	}
+	data, _ := ioutil.ReadFile(m.checkpointFile)
+	if len(data) == 0 || bytes.Contains(data, []byte("secret")) {
+		t.Errorf("state file is empty or holds the API key")
+	}
+
+	resumed, err := resumedModel(m.checkpointFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.state != executingPlan || resumed.currentStep != 1 || !resumed.config.ApproveHighRisk {
+		t.Errorf("resumed at state %d step %d", resumed.state, resumed.currentStep)
+	}
+	if !reflect.DeepEqual(resumed.run.validation, m.run.validation) {
+		t.Errorf("validation report not restored")
+	}
+	for i, step := range resumed.executionSteps {
+		want := m.executionSteps[i]
+		if step.Status != want.Status || step.Details != want.Details || errorText(step.Error) != errorText(want.Error) {
+			t.Errorf("step %d = %+v, want %+v", i+1, step, want)
+		}
+	}
+}
+
+func TestResumeRefusals(t *testing.T) {
+	tests := []struct {
+		name  string
+		spoil func(m model)
+	}{
+		{"source changed", func(m model) {
+			ioutil.WriteFile(m.config.SourceFile, []byte(`{"users": []}`), 0644)
+		}},
+		{"truncated state file", func(m model) {
+			data, _ := ioutil.ReadFile(m.checkpointFile)
+			ioutil.WriteFile(m.checkpointFile, data[:len(data)/2], 0644)
+		}},
+		{"no plan", func(m model) {
+			ioutil.WriteFile(m.checkpointFile, []byte(`{"current_step": 0}`), 0644)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := checkpointedModel(t).saveCheckpoint()
+			tt.spoil(m)
+			if _, err := resumedModel(m.checkpointFile); err == nil {
+				t.Error("resumed anyway")
+			}
+		})
+	}
+}
+
+func TestReplaceJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "migration-state.json")
+	if err := replaceJSONFile(path, map[string]int{"current_step": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceJSONFile(path, map[string]int{"current_step": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceJSONFile(path, map[string]interface{}{"current_step": make(chan int)}); err == nil {
+		t.Fatal("replaced the file with a value that does not marshal")
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if !bytes.Contains(data, []byte(`"current_step": 2`)) {
+		t.Errorf("state file = %s", data)
+	}
+	if files, _ := filepath.Glob(path + ".tmp-*"); len(files) > 0 {
+		t.Errorf("temporary files left behind: %v", files)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Users or numbers planned per Engine Room AI call when LLMConfig.ChunkSize
+// is zero. Each entry of a recommended order costs roughly a hundred output
+// tokens, so this keeps a chunk well under the default response limit.
+const defaultPlanChunkSize = 25
+
+// Progress of a chunked planning run, reported after every call
+type PlanProgress struct {
+	Chunk     int    // chunks planned so far
+	Chunks    int    // total number of chunks
+	Stage     string // what is happening now
+	Completed bool   // the consolidation call has finished
+}
+
+// planInChunks plans users, then numbers, chunkSize at a time, merges the
+// partial orders into global ones and asks for a single consolidated to-do
+// list and risk assessment.
+func (c *EngineRoomEnhancedMigrator) planInChunks(ctx context.Context, system *CanonicalPhoneSystem, targetFormat string) (*MigrationPlan, error) {
+	// One redactor for the whole run keeps tokens consistent across chunks
+	redactor, err := newRedactor(c.redaction)
+	if err != nil {
+		return nil, err
+	}
+	users := redactor.RedactUsers(system.Users)
+	numbers := redactor.RedactNumbers(system.Numbers)
+
+	userChunks := chunkCount(len(users), c.chunkSize)
+	numberChunks := chunkCount(len(numbers), c.chunkSize)
+	chunks := userChunks + numberChunks
+	var userPartials [][]AccountWithPriority
+	var numberPartials [][]NumberWithPriority
+	var chunkNotes []string
+	repairs := 0
+
+	for i := 0; i < chunks; i++ {
+		var stage, prompt string
+		var validate func(*MigrationPlan) error
+		if i < userChunks {
+			start, end := chunkBounds(i, c.chunkSize, len(users))
+			stage = fmt.Sprintf("Planning users %d-%d of %d", start+1, end, len(users))
+			usersJSON, err := json.MarshalIndent(users[start:end], "", "  ")
+			if err != nil {
+				return nil, err
+			}
+			prompt = chunkPlanPrompt(i+1, userChunks, len(users), string(usersJSON))
+			validate = validatePlanChunk
+		} else {
+			start, end := chunkBounds(i-userChunks, c.chunkSize, len(numbers))
+			stage = fmt.Sprintf("Planning numbers %d-%d of %d", start+1, end, len(numbers))
+			numbersJSON, err := json.MarshalIndent(numbers[start:end], "", "  ")
+			if err != nil {
+				return nil, err
+			}
+			prompt = numberChunkPrompt(i-userChunks+1, numberChunks, len(numbers), string(numbersJSON), targetFormat)
+			validate = validateNumberChunk
+		}
+		c.reportProgress(PlanProgress{Chunk: i, Chunks: chunks, Stage: stage})
+
+		partial, err := c.requestPlan(ctx, prompt, validate)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d of %d: %w", i+1, chunks, err)
+		}
+		repairs += partial.Repairs
+		if i < userChunks {
+			userPartials = append(userPartials, partial.RecommendedOrder)
+		} else {
+			numberPartials = append(numberPartials, partial.NumberPlan)
+		}
+		if partial.Reasoning != "" {
+			chunkNotes = append(chunkNotes, fmt.Sprintf("Batch %d: %s", i+1, partial.Reasoning))
+		}
+	}
+
+	order := mergeByRank(userPartials, func(item AccountWithPriority) int { return item.Priority })
+	for i := range order {
+		order[i].Priority = i + 1
+	}
+	numberPlan := mergeByRank(numberPartials, func(item NumberWithPriority) int { return item.Priority })
+	for i := range numberPlan {
+		numberPlan[i].Priority = i + 1
+	}
+
+	c.reportProgress(PlanProgress{Chunk: chunks, Chunks: chunks, Stage: "Consolidating the to-do list and risk assessment"})
+	summary, err := c.requestPlan(ctx, consolidationPrompt(order, numberPlan, chunkNotes), validatePlanSummary)
+	if err != nil {
+		return nil, fmt.Errorf("consolidation: %w", err)
+	}
+	c.reportProgress(PlanProgress{Chunk: chunks, Chunks: chunks, Stage: "Plan ready", Completed: true})
+
+	plan := &MigrationPlan{
+		RecommendedOrder: order,
+		NumberPlan:       numberPlan,
+		Reasoning:        summary.Reasoning,
+		RiskAssessment:   summary.RiskAssessment,
+		TodoList:         summary.TodoList,
+		EstimatedTime:    summary.EstimatedTime,
+		GeneratedBy:      planGeneratorEngineRoom,
+		Repairs:          repairs + summary.Repairs,
+	}
+	redactor.RestorePlan(plan)
+	plan.RedactionKeyID = redactor.KeyID()
+	plan.Usage = c.Usage()
+	return plan, nil
+}
+
+func chunkCount(items, size int) int {
+	return (items + size - 1) / size
+}
+
+func chunkBounds(chunk, size, items int) (int, int) {
+	start := chunk * size
+	end := start + size
+	if end > items {
+		end = items
+	}
+	return start, end
+}
+
+func (c *EngineRoomEnhancedMigrator) reportProgress(progress PlanProgress) {
+	if c.onProgress != nil {
+		c.onProgress(progress)
+	}
+}
+
+// mergeByRank interleaves per-chunk orders by relative rank: the first entry
+// of every chunk comes before the second of any chunk, and so on
+// proportionally for chunks of different sizes. Ties keep chunk order.
+func mergeByRank[T any](partials [][]T, priority func(T) int) []T {
+	type ranked struct {
+		item  T
+		rank  float64
+		chunk int
+	}
+
+	var all []ranked
+	for chunk, partial := range partials {
+		sorted := append([]T{}, partial...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return priority(sorted[i]) < priority(sorted[j])
+		})
+		for pos, item := range sorted {
+			all = append(all, ranked{
+				item:  item,
+				rank:  (float64(pos) + 0.5) / float64(len(sorted)),
+				chunk: chunk,
+			})
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].rank != all[j].rank {
+			return all[i].rank < all[j].rank
+		}
+		return all[i].chunk < all[j].chunk
+	})
+
+	merged := make([]T, len(all))
+	for i, entry := range all {
+		merged[i] = entry.item
+	}
+	return merged
+}
+
+func chunkPlanPrompt(chunk, chunks, total int, usersJSON string) string {
+	return fmt.Sprintf(`You are a phone system migration expert. A migration of %d user accounts is being planned in batches. This is batch %d of %d.
+
+User Accounts in this batch:
+%s
+
+Rank every account in this batch in the order it should be migrated, with a reason and a risk level (low, medium or high) for each. Priorities start at 1 within the batch and must be unique.
+
+Respond with a JSON object in this exact format:
+{
+  "recommended_order": [
+    {
+      "account": {
+        "id": "AC123",
+        "name": "John Doe",
+        "email": "john@example.com",
+        "phone_number": "+1234567890",
+        "status": "active"
+      },
+      "priority": 1,
+      "reason": "Admin user - needs to be migrated first to maintain system management",
+      "risk_level": "low"
+    }
+  ],
+  "reasoning": "One or two sentences on what stands out in this batch"
+}
+
+Copy each account exactly as given.`, total, chunk, chunks, usersJSON)
+}
+
+func numberChunkPrompt(chunk, chunks, total int, numbersJSON, targetFormat string) string {
+	return fmt.Sprintf(`You are a phone system migration expert. A migration of %d phone numbers is being planned in batches. This is batch %d of %d.
+
+Phone Numbers in this batch:
+%s
+
+%s
+
+Rank every number in this batch in the order it should be ported, with a reason and a risk level (low, medium or high) for each. Priorities start at 1 within the batch and must be unique.
+
+Respond with a JSON object in this exact format:
+{
+  "number_plan": [
+    {
+      "number": {
+        "id": "PN123",
+        "phone_number": "+1234567890",
+        "capabilities": {"voice": true, "sms": true, "fax": true},
+        "location": "New York, NY"
+      },
+      "priority": 1,
+      "reason": "Main office line - port early in a quiet period so problems are found quickly",
+      "risk_level": "medium",
+      "capabilities_at_risk": ["fax"]
+    }
+  ],
+  "reasoning": "One or two sentences on what stands out in this batch"
+}
+
+Copy each number exactly as given.`, total, chunk, chunks, numbersJSON, targetCapabilitiesNote(targetFormat))
+}
+
+// consolidationPrompt describes the merged orders without repeating every
+// entry, so it stays small however many users and numbers there are.
+func consolidationPrompt(order []AccountWithPriority, numberPlan []NumberWithPriority, chunkNotes []string) string {
+	risks := make(map[string]int)
+	statuses := make(map[string]int)
+	for _, item := range order {
+		risks[item.Risk]++
+		statuses[item.Account.Status]++
+	}
+
+	var riskCounts, statusCounts []string
+	for _, risk := range planRiskLevels {
+		riskCounts = append(riskCounts, fmt.Sprintf("%s: %d", risk, risks[risk]))
+	}
+	for _, status := range sortedKeys(statuses) {
+		statusCounts = append(statusCounts, fmt.Sprintf("%s: %d", status, statuses[status]))
+	}
+
+	var first []string
+	for i, item := range order {
+		if i == 10 {
+			break
+		}
+		first = append(first, fmt.Sprintf("%d. %s (%s, %s risk) - %s", item.Priority, item.Account.Name, item.Account.ID, item.Risk, item.Reason))
+	}
+
+	numberRisks := make(map[string]int)
+	atRisk := 0
+	var firstNumbers []string
+	for i, item := range numberPlan {
+		numberRisks[item.Risk]++
+		if len(item.CapabilitiesAtRisk) > 0 {
+			atRisk++
+		}
+		if i < 10 {
+			firstNumbers = append(firstNumbers, fmt.Sprintf("%d. %s (%s risk) - %s", item.Priority, item.Number.Number, item.Risk, item.Reason))
+		}
+	}
+	var numberRiskCounts []string
+	for _, risk := range planRiskLevels {
+		numberRiskCounts = append(numberRiskCounts, fmt.Sprintf("%s: %d", risk, numberRisks[risk]))
+	}
+
+	return fmt.Sprintf(`You are a phone system migration expert. The migration order for %d user accounts and the porting order for %d phone numbers have already been decided in batches. Write the overall plan for them.
+
+Accounts by risk level: %s
+Accounts by status: %s
+Numbers by risk level: %s
+Numbers with capabilities the target cannot express: %d
+
+First accounts in the migration order:
+%s
+
+First numbers in the porting order:
+%s
+
+Notes from each batch:
+%s
+
+Respond with a JSON object in this exact format:
+{
+  "reasoning": "Overall strategy explanation focusing on minimizing business disruption",
+  "risk_assessment": "Detailed risk analysis and mitigation strategies",
+  "todo_list": [
+    {
+      "step": 1,
+      "description": "Backup current system data",
+      "action": "Create full backup of the source system configuration and user data",
+      "risk": "low",
+      "executor": "backup"
+    }
+  ],
+  "estimated_time": "Estimated time for the whole migration"
+}
+
+Create a comprehensive to-do list with 5-8 steps that covers the entire migration process from preparation to completion.
+Set "executor" on each step to the automated operation that performs it: backup, validate, order, convert_users, convert_numbers, roundtrip, verify or write.
+Use "manual" for steps that need a person to act, such as notifying users.`,
+		len(order), len(numberPlan), strings.Join(riskCounts, ", "), strings.Join(statusCounts, ", "),
+		strings.Join(numberRiskCounts, ", "), atRisk,
+		strings.Join(first, "\n"), strings.Join(firstNumbers, "\n"), strings.Join(chunkNotes, "\n"))
+}
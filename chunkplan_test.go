@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func rankedAccounts(ids ...string) []AccountWithPriority {
+	items := make([]AccountWithPriority, len(ids))
+	for i, id := range ids {
+		items[i] = AccountWithPriority{Account: CanonicalUser{ID: id}, Priority: i + 1}
+	}
+	return items
+}
+
+func TestMergeByRank(t *testing.T) {
+	// The second chunk lists its accounts out of priority order
+	second := rankedAccounts("b1", "b2")
+	second[0].Priority, second[1].Priority = 2, 1
+
+	merged := mergeByRank([][]AccountWithPriority{
+		rankedAccounts("a1", "a2", "a3", "a4"),
+		second,
+		rankedAccounts("c1"),
+	}, func(item AccountWithPriority) int { return item.Priority })
+
+	var ids []string
+	for _, item := range merged {
+		ids = append(ids, item.Account.ID)
+	}
+	// Ranks: a 0.125 0.375 0.625 0.875, b 0.25 0.75, c 0.5
+	if want := []string{"a1", "b2", "a2", "c1", "a3", "b1", "a4"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("merged order = %v, want %v", ids, want)
+	}
+
+	// Numbers merge the same way
+	numbers := mergeByRank([][]NumberWithPriority{
+		{{Number: CanonicalNumber{ID: "n1"}, Priority: 1}, {Number: CanonicalNumber{ID: "n2"}, Priority: 2}},
+		{{Number: CanonicalNumber{ID: "m1"}, Priority: 1}},
+	}, func(item NumberWithPriority) int { return item.Priority })
+	if len(numbers) != 3 || numbers[0].Number.ID != "n1" || numbers[1].Number.ID != "m1" {
+		t.Errorf("merged numbers = %+v", numbers)
+	}
+	if len(mergeByRank(nil, func(item NumberWithPriority) int { return item.Priority })) != 0 {
+		t.Error("merging no chunks produced entries")
+	}
+}
+
+func TestPlanInChunks(t *testing.T) {
+	users := []CanonicalUser{
+		{ID: "AC1", Name: "One", Status: "active"},
+		{ID: "AC2", Name: "Two", Status: "active"},
+		{ID: "AC3", Name: "Three", Status: "inactive"},
+	}
+	chunk := func(reasoning string, users ...CanonicalUser) string {
+		plan := MigrationPlan{Reasoning: reasoning}
+		for i := len(users) - 1; i >= 0; i-- {
+			plan.RecommendedOrder = append(plan.RecommendedOrder, AccountWithPriority{
+				Account: users[i], Priority: len(plan.RecommendedOrder) + 1, Reason: "reversed", Risk: "low",
+			})
+		}
+		data, _ := json.Marshal(plan)
+		return string(data)
+	}
+	summary := offlineTestPlan(t)
+	summary.RecommendedOrder = nil
+	summaryJSON, _ := json.Marshal(summary)
+
+	provider := &scriptedProvider{responses: []string{
+		chunk("first batch", users[0], users[1]),
+		chunk("second batch", users[2]),
+		string(summaryJSON),
+	}}
+	migrator := testMigrator(provider)
+	migrator.redaction = RedactionPolicy{}
+	migrator.chunkSize = 2
+	var progress []PlanProgress
+	migrator.onProgress = func(p PlanProgress) { progress = append(progress, p) }
+
+	plan, err := migrator.PlanMigrationOrder(context.Background(), &CanonicalPhoneSystem{Users: users}, "RingCentral")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := plannedIDs(plan); !reflect.DeepEqual(got, []string{"AC2", "AC3", "AC1"}) {
+		t.Errorf("order = %v", got)
+	}
+	if !reflect.DeepEqual(plan.TodoList, summary.TodoList) || plan.GeneratedBy != planGeneratorEngineRoom {
+		t.Errorf("plan did not take the consolidated to-do list: %+v", plan)
+	}
+	if len(provider.sent) != 3 {
+		t.Errorf("sent %d requests, want 2 chunks and a consolidation", len(provider.sent))
+	}
+	if last := progress[len(progress)-1]; len(progress) != 4 || !last.Completed || last.Chunks != 2 {
+		t.Errorf("progress = %+v", progress)
+	}
+}
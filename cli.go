@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// Exit codes for headless runs
+const (
+	exitOK          = 0
+	exitError       = 1 // the command could not run (I/O, API, conversion errors)
+	exitUsage       = 2 // bad arguments
+	exitCheckFailed = 3 // the command ran but validation failed, differences were found or a rollback was refused
+)
+
+// Machine-readable summary printed to stdout for every CLI command
+type CommandSummary struct {
+	Command      string      `json:"command"`
+	Success      bool        `json:"success"`
+	ExitCode     int         `json:"exit_code"`
+	SourceFile   string      `json:"source_file,omitempty"`
+	SourceFormat string      `json:"source_format,omitempty"`
+	TargetFile   string      `json:"target_file,omitempty"`
+	TargetFormat string      `json:"target_format,omitempty"`
+	UseAI        bool        `json:"use_ai"`
+	OutputFile   string      `json:"output_file,omitempty"`
+	DurationMS   int64       `json:"duration_ms"`
+	Result       interface{} `json:"result,omitempty"`
+	Warning      string      `json:"warning,omitempty"` // the command succeeded, but not quite as asked
+	Error        string      `json:"error,omitempty"`
+}
+
+// Flags shared by every subcommand
+type cliOptions struct {
+	ctx           context.Context // cancelled on interrupt
+	config        MigrationConfig
+	output        string
+	capabilityMap string
+	prices        string
+}
+
+type cliCommand struct {
+	name        string
+	description string
+	run         func(opts cliOptions, summary *CommandSummary) int
+}
+
+var cliCommands = []cliCommand{
+	{"convert", "Convert the source file into the target format", runConvertCommand},
+	{"plan", "Generate a migration plan (offline planner unless --ai, which needs --target-format)", runPlanCommand},
+	{"validate", "Check that the source file can be migrated", runValidateCommand},
+	{"diff", "Compare the source and target files record by record", runDiffCommand},
+	{"roundtrip", "Convert the source to the target format and back, and diff the result", runRoundTripCommand},
+	{"rollback", "Undo the migration that wrote the target file, after verifying its checksums", runRollbackCommand},
+}
+
+func runCLI(args []string) int {
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printCLIUsage()
+		return exitOK
+	}
+
+	summary := CommandSummary{Command: args[0]}
+	var command *cliCommand
+	for i := range cliCommands {
+		if cliCommands[i].name == args[0] {
+			command = &cliCommands[i]
+		}
+	}
+	if command == nil {
+		summary.Error = "unknown command: " + args[0]
+		fmt.Fprintf(os.Stderr, "%s\n\n", summary.Error)
+		printCLIUsage()
+		return printSummary(summary, exitUsage)
+	}
+
+	var opts cliOptions
+	flags := flag.NewFlagSet(command.name, flag.ContinueOnError)
+	flags.StringVar(&opts.config.SourceFile, "source", "", "source JSON file")
+	flags.StringVar(&opts.config.SourceFormat, "source-format", "", "source format ("+formatList()+")")
+	flags.StringVar(&opts.config.TargetFile, "target", "", "target JSON file")
+	flags.StringVar(&opts.config.TargetFormat, "target-format", "", "target format ("+formatList()+")")
+	flags.BoolVar(&opts.config.UseAI, "ai", false, "use Engine Room AI")
+	flags.StringVar(&opts.output, "output", "", "also write the command result to this file")
+	flags.StringVar(&opts.capabilityMap, "capability-map", "", "JSON capability mapping file")
+	opts.config.LLM = llmConfigFromEnv()
+	flags.StringVar(&opts.config.LLM.Provider, "provider", opts.config.LLM.Provider, "Engine Room AI provider (anthropic, openai, replay)")
+	flags.StringVar(&opts.config.LLM.Model, "model", opts.config.LLM.Model, "Engine Room AI model")
+	flags.IntVar(&opts.config.LLM.MaxTokens, "max-tokens", opts.config.LLM.MaxTokens, "maximum tokens per Engine Room AI response")
+	flags.StringVar(&opts.config.LLM.BaseURL, "base-url", opts.config.LLM.BaseURL, "Engine Room AI API base URL")
+	flags.DurationVar(&opts.config.LLM.Timeout, "llm-timeout", opts.config.LLM.Timeout, "Engine Room AI request timeout")
+	flags.StringVar(&opts.config.LLM.FixtureFile, "fixtures", opts.config.LLM.FixtureFile, "fixture file or .jsonl exchange log for the replay provider")
+	flags.StringVar(&opts.config.LLM.RecordFile, "record", opts.config.LLM.RecordFile, "append Engine Room AI exchanges to this JSONL file (empty to disable)")
+	flags.StringVar(&opts.config.LLM.Redaction, "redact", opts.config.LLM.Redaction, "redaction policy for data sent to Engine Room AI, e.g. name=hash,email=mask (off to disable)")
+	flags.Float64Var(&opts.config.LLM.Budget, "budget", opts.config.LLM.Budget, "Engine Room AI budget in US dollars (0 for no limit)")
+	flags.StringVar(&opts.prices, "prices", "", "JSON model price table")
+	flags.IntVar(&opts.config.LLM.ChunkSize, "chunk-size", opts.config.LLM.ChunkSize, "users or numbers planned per Engine Room AI call (0 for the default)")
+	flags.IntVar(&opts.config.LLM.MaxAttempts, "max-attempts", opts.config.LLM.MaxAttempts, "Engine Room AI attempts per call, including retries (0 for the default)")
+	if err := flags.Parse(args[1:]); err != nil {
+		// The flag package has already printed the error and usage
+		summary.Error = err.Error()
+		return printSummary(summary, exitUsage)
+	}
+	opts.config.LLM.APIKey = llmAPIKey(opts.config.LLM.Provider)
+	summary.OutputFile = opts.output
+	if opts.capabilityMap != "" {
+		if err := LoadCapabilityMappings(opts.capabilityMap); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			summary.Error = err.Error()
+			return printSummary(summary, exitUsage)
+		}
+	}
+	if opts.prices != "" {
+		if err := LoadModelPrices(opts.prices); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			summary.Error = err.Error()
+			return printSummary(summary, exitUsage)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts.ctx = ctx
+
+	start := time.Now()
+	code := resolveFormats(&opts.config, &summary)
+	if code == exitOK {
+		code = command.run(opts, &summary)
+	}
+	summary.DurationMS = time.Since(start).Milliseconds()
+
+	summary.SourceFile = opts.config.SourceFile
+	summary.SourceFormat = opts.config.SourceFormat
+	summary.TargetFile = opts.config.TargetFile
+	summary.TargetFormat = opts.config.TargetFormat
+	summary.UseAI = opts.config.UseAI
+
+	if code != exitUsage && opts.output != "" && summary.Result != nil {
+		if err := writeJSONFile(opts.output, summary.Result); err != nil {
+			summary.Error = err.Error()
+			code = exitError
+		}
+	}
+	return printSummary(summary, code)
+}
+
+// printSummary prints summary to stdout with the exit code it ends with.
+func printSummary(summary CommandSummary, code int) int {
+	summary.ExitCode = code
+	summary.Success = code == exitOK
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(summary)
+
+	return code
+}
+
+func printCLIUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: phone-migration-tool [command] [flags]")
+	fmt.Fprintln(os.Stderr, "\nRun without a command to start the interactive wizard.")
+	fmt.Fprintln(os.Stderr, "Run 'resume [STATE_FILE]' to continue an interrupted migration from "+defaultCheckpointFile+" or STATE_FILE.")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, command := range cliCommands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", command.name, command.description)
+	}
+	fmt.Fprintln(os.Stderr, "\nFlags:")
+	fmt.Fprintln(os.Stderr, "  --source FILE          source JSON file")
+	fmt.Fprintln(os.Stderr, "  --source-format NAME   source format ("+formatList()+")")
+	fmt.Fprintln(os.Stderr, "  --target FILE          target JSON file")
+	fmt.Fprintln(os.Stderr, "  --target-format NAME   target format ("+formatList()+")")
+	fmt.Fprintln(os.Stderr, "  --ai                   use Engine Room AI (needs ANTHROPIC_API_KEY for the default provider)")
+	fmt.Fprintln(os.Stderr, "  --output FILE          also write the command result to this file")
+	fmt.Fprintln(os.Stderr, "  --capability-map FILE  JSON capability mapping file (default: $"+capabilityMapEnv+" or built-in)")
+	fmt.Fprintln(os.Stderr, "\nEngine Room AI flags (defaults from ENGINE_ROOM_* environment variables):")
+	fmt.Fprintln(os.Stderr, "  --provider NAME        anthropic, openai or replay")
+	fmt.Fprintln(os.Stderr, "  --model NAME           model name")
+	fmt.Fprintln(os.Stderr, "  --max-tokens N         maximum tokens per response")
+	fmt.Fprintln(os.Stderr, "  --base-url URL         API base URL, e.g. a local OpenAI-compatible server")
+	fmt.Fprintln(os.Stderr, "  --llm-timeout DURATION request timeout (default 30s)")
+	fmt.Fprintln(os.Stderr, "  --fixtures FILE        fixture file or .jsonl exchange log for the replay provider")
+	fmt.Fprintln(os.Stderr, "  --record FILE          exchange log every live call's prompt and response is appended to,")
+	fmt.Fprintln(os.Stderr, "                         redacted as --redact says. On by default, in the wizard too, writing")
+	fmt.Fprintln(os.Stderr, "                         "+defaultRecordFile+"; --record \"\" or ENGINE_ROOM_RECORD=off disables it")
+	fmt.Fprintln(os.Stderr, "  --max-attempts N       attempts per call including retries (default 4)")
+	fmt.Fprintln(os.Stderr, "  --redact POLICY        field=mode list, modes none/hash/mask (default name=hash,email=mask,phone_number=mask)")
+	fmt.Fprintln(os.Stderr, "                         hash tokens use $"+redactionKeyEnv+", or a random key per run when unset;")
+	fmt.Fprintln(os.Stderr, "                         an exchange log replays only with the key it was recorded with")
+	fmt.Fprintln(os.Stderr, "  --budget USD           refuse further calls once this estimated cost is reached (default no limit)")
+	fmt.Fprintln(os.Stderr, "  --prices FILE          JSON model price table (default: $"+modelPricesEnv+" or built-in)")
+	fmt.Fprintln(os.Stderr, "  --chunk-size N         users or numbers planned per call for large sources (default 25)")
+	fmt.Fprintln(os.Stderr, "\nExit codes: 0 success, 1 error, 2 usage, 3 validation failed, differences found or rollback refused")
+}
+
+func formatList() string {
+	return strings.Join(AdapterNames(), ", ")
+}
+
+// requireFlags reports a usage error for the first empty flag value.
+func requireFlags(summary *CommandSummary, flags map[string]string) int {
+	for _, name := range []string{"source", "source-format", "target", "target-format"} {
+		if value, ok := flags[name]; ok && value == "" {
+			summary.Error = fmt.Sprintf("--%s is required for %s", name, summary.Command)
+			return exitUsage
+		}
+	}
+	return exitOK
+}
+
+// resolveFormats normalizes the format flags to registered adapter names.
+func resolveFormats(config *MigrationConfig, summary *CommandSummary) int {
+	for _, format := range []*string{&config.SourceFormat, &config.TargetFormat} {
+		if *format == "" {
+			continue
+		}
+		adapter, err := GetAdapter(*format)
+		if err != nil {
+			summary.Error = err.Error()
+			return exitUsage
+		}
+		*format = adapter.Name()
+	}
+	return exitOK
+}
+
+func runConvertCommand(opts cliOptions, summary *CommandSummary) int {
+	config := opts.config
+	if code := requireFlags(summary, map[string]string{
+		"source":        config.SourceFile,
+		"source-format": config.SourceFormat,
+		"target":        config.TargetFile,
+		"target-format": config.TargetFormat,
+	}); code != exitOK {
+		return code
+	}
+
+	source, code := loadCanonicalFile(config.SourceFile, config.SourceFormat, summary)
+	if code != exitOK {
+		return code
+	}
+
+	var err error
+	if config.UseAI {
+		err = migrateWithEngineRoom(opts.ctx, config)
+	} else {
+		err = migrate(config)
+	}
+	if err != nil {
+		summary.Error = err.Error()
+		return exitError
+	}
+
+	summary.Result = map[string]interface{}{
+		"target_file":           config.TargetFile,
+		"unmapped_capabilities": unmappedCapabilities(source, config.TargetFormat),
+	}
+	return exitOK
+}
+
+func runPlanCommand(opts cliOptions, summary *CommandSummary) int {
+	config := opts.config
+	required := map[string]string{
+		"source":        config.SourceFile,
+		"source-format": config.SourceFormat,
+	}
+	if config.UseAI {
+		// Engine Room AI plans the numbers for the target's capabilities
+		required["target-format"] = config.TargetFormat
+	}
+	if code := requireFlags(summary, required); code != exitOK {
+		return code
+	}
+	plan, err := buildMigrationPlan(opts.ctx, config, nil)
+	if err != nil {
+		summary.Error = err.Error()
+		return exitError
+	}
+	if config.UseAI && plan.GeneratedBy == planGeneratorOffline {
+		summary.Warning = fmt.Sprintf("Engine Room AI unavailable (%v) - the plan was made by the offline planner", config.LLM.Check())
+	}
+
+	summary.Result = plan
+	return exitOK
+}
+
+func runValidateCommand(opts cliOptions, summary *CommandSummary) int {
+	config := opts.config
+	if code := requireFlags(summary, map[string]string{
+		"source":        config.SourceFile,
+		"source-format": config.SourceFormat,
+	}); code != exitOK {
+		return code
+	}
+
+	data, err := ioutil.ReadFile(config.SourceFile)
+	if err != nil {
+		summary.Error = fmt.Sprintf("failed to read %s: %v", config.SourceFile, err)
+		return exitError
+	}
+	report, err := ValidateSource(config.SourceFormat, data)
+	if err != nil {
+		summary.Error = err.Error()
+		return exitCheckFailed
+	}
+
+	result := map[string]interface{}{
+		"validation_report": report,
+	}
+	summary.Result = result
+
+	if report.Users == 0 && report.Numbers == 0 {
+		summary.Error = fmt.Sprintf("no users or numbers found - is %s really a %s export?", config.SourceFile, config.SourceFormat)
+		return exitCheckFailed
+	}
+
+	if config.UseAI {
+		engineRoomMigrator, err := NewEngineRoomEnhancedMigrator(config.LLM)
+		if err != nil {
+			summary.Error = err.Error()
+			return exitError
+		}
+		system, code := loadCanonicalFile(config.SourceFile, config.SourceFormat, summary)
+		if code != exitOK {
+			return code
+		}
+		analysis, err := engineRoomMigrator.AnalyzeDataQuality(opts.ctx, system)
+		if err != nil {
+			summary.Error = fmt.Sprintf("data quality analysis failed: %v", err)
+			return exitError
+		}
+		result["data_quality"] = analysis
+		result["engine_room_usage"] = engineRoomMigrator.Usage()
+	}
+
+	if report.HasErrors() {
+		summary.Error = "validation failed: " + report.Summary()
+		return exitCheckFailed
+	}
+	return exitOK
+}
+
+func runDiffCommand(opts cliOptions, summary *CommandSummary) int {
+	config := opts.config
+	if code := requireFlags(summary, map[string]string{
+		"source":        config.SourceFile,
+		"source-format": config.SourceFormat,
+		"target":        config.TargetFile,
+		"target-format": config.TargetFormat,
+	}); code != exitOK {
+		return code
+	}
+
+	source, code := loadCanonicalFile(config.SourceFile, config.SourceFormat, summary)
+	if code != exitOK {
+		return code
+	}
+	target, code := loadTargetFile(config.TargetFile, config.TargetFormat, summary)
+	if code != exitOK {
+		return code
+	}
+
+	diffs := diffSystems(source, target)
+	if diffs == nil {
+		// No differences are listed as [] rather than null
+		diffs = []SystemDifference{}
+	}
+	summary.Result = map[string]interface{}{
+		"differences": diffs,
+		"count":       len(diffs),
+	}
+	if len(diffs) > 0 {
+		return exitCheckFailed
+	}
+	return exitOK
+}
+
+func runRoundTripCommand(opts cliOptions, summary *CommandSummary) int {
+	config := opts.config
+	if code := requireFlags(summary, map[string]string{
+		"source":        config.SourceFile,
+		"source-format": config.SourceFormat,
+		"target-format": config.TargetFormat,
+	}); code != exitOK {
+		return code
+	}
+
+	data, err := ioutil.ReadFile(config.SourceFile)
+	if err != nil {
+		summary.Error = fmt.Sprintf("failed to read %s: %v", config.SourceFile, err)
+		return exitError
+	}
+
+	report, err := checkRoundTrip(config.SourceFormat, config.TargetFormat, data)
+	if err != nil {
+		summary.Error = err.Error()
+		return exitError
+	}
+
+	summary.Result = report
+	if !report.Lossless {
+		return exitCheckFailed
+	}
+	return exitOK
+}
+
+func runRollbackCommand(opts cliOptions, summary *CommandSummary) int {
+	config := opts.config
+	if code := requireFlags(summary, map[string]string{
+		"target": config.TargetFile,
+	}); code != exitOK {
+		return code
+	}
+
+	done, err := RollbackMigration(config.TargetFile)
+	if len(done) > 0 {
+		summary.Result = map[string]interface{}{
+			"actions": done,
+		}
+	}
+	var checkErr *RollbackCheckError
+	if errors.As(err, &checkErr) {
+		summary.Error = err.Error()
+		return exitCheckFailed
+	}
+	if err != nil {
+		summary.Error = err.Error()
+		return exitError
+	}
+	return exitOK
+}
+
+func loadCanonicalFile(path, format string, summary *CommandSummary) (*CanonicalPhoneSystem, int) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		summary.Error = fmt.Sprintf("failed to read %s: %v", path, err)
+		return nil, exitError
+	}
+	return decodeCanonical(path, format, data, summary)
+}
+
+// loadTargetFile decodes a migration target, which is either a platform
+// export or the enhanced output holding one under converted_data.
+func loadTargetFile(path, format string, summary *CommandSummary) (*CanonicalPhoneSystem, int) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		summary.Error = fmt.Sprintf("failed to read %s: %v", path, err)
+		return nil, exitError
+	}
+
+	var enhanced struct {
+		ConvertedData json.RawMessage `json:"converted_data"`
+	}
+	if json.Unmarshal(data, &enhanced) == nil && len(enhanced.ConvertedData) > 0 {
+		data = enhanced.ConvertedData
+	}
+	adapter, err := GetAdapter(format)
+	if err != nil {
+		summary.Error = err.Error()
+		return nil, exitUsage
+	}
+	if detector, ok := adapter.(FormatDetector); ok && !detector.Detect(data) {
+		summary.Error = fmt.Sprintf("%s is not a %s platform export", path, format)
+		return nil, exitCheckFailed
+	}
+	return decodeCanonical(path, format, data, summary)
+}
+
+func decodeCanonical(path, format string, data []byte, summary *CommandSummary) (*CanonicalPhoneSystem, int) {
+	adapter, err := GetAdapter(format)
+	if err != nil {
+		summary.Error = err.Error()
+		return nil, exitUsage
+	}
+
+	system, err := adapter.Decode(data)
+	if err != nil {
+		summary.Error = fmt.Sprintf("failed to parse %s as %s: %v", path, format, err)
+		return nil, exitCheckFailed
+	}
+	return system, exitOK
+}
+
+func writeJSONFile(path string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", path, err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
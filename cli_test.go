@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCLIForTest runs a command and decodes the summary it prints.
+func runCLIForTest(t *testing.T, args ...string) (int, CommandSummary) {
+	t.Helper()
+	stdout, err := ioutil.TempFile(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+
+	saved := os.Stdout
+	os.Stdout = stdout
+	code := runCLI(args)
+	os.Stdout = saved
+
+	var summary CommandSummary
+	data, _ := ioutil.ReadFile(stdout.Name())
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &summary); err != nil {
+			t.Fatalf("summary is not JSON: %v\n%s", err, data)
+		}
+	}
+	return code, summary
+}
+
+func TestCLIExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.json")
+	if err := ioutil.WriteFile(empty, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	converted := filepath.Join(dir, "converted.json")
+	if code, summary := runCLIForTest(t, "convert", "--source", "twilio-sample.json", "--source-format", "twilio",
+		"--target", converted, "--target-format", "RingCentral"); code != exitOK {
+		t.Fatalf("convert exited %d: %s", code, summary.Error)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"unknown command", []string{"migrate", "--source", "twilio-sample.json"}, exitUsage},
+		{"undefined flag", []string{"validate", "--sauce", "twilio-sample.json"}, exitUsage},
+		{"missing capability map", []string{"validate", "--source", "twilio-sample.json", "--source-format", "Twilio",
+			"--capability-map", filepath.Join(dir, "missing.json")}, exitUsage},
+		{"missing flag", []string{"convert", "--source", "twilio-sample.json"}, exitUsage},
+		{"unknown format", []string{"validate", "--source", "twilio-sample.json", "--source-format", "Teams"}, exitUsage},
+		{"missing source", []string{"validate", "--source", filepath.Join(dir, "missing.json"), "--source-format", "Twilio"}, exitError},
+		{"valid source", []string{"validate", "--source", "twilio-sample.json", "--source-format", "Twilio"}, exitOK},
+		{"empty source", []string{"validate", "--source", empty, "--source-format", "Twilio"}, exitCheckFailed},
+		{"offline plan", []string{"plan", "--source", "twilio-sample.json", "--source-format", "Twilio"}, exitOK},
+		{"AI plan without a target", []string{"plan", "--ai", "--source", "twilio-sample.json", "--source-format", "Twilio"}, exitUsage},
+		{"diff of a lossless conversion", []string{"diff", "--source", "twilio-sample.json", "--source-format", "Twilio",
+			"--target", converted, "--target-format", "RingCentral"}, exitOK},
+		{"diff against an empty target", []string{"diff", "--source", "twilio-sample.json", "--source-format", "Twilio",
+			"--target", empty, "--target-format", "Twilio"}, exitCheckFailed},
+		{"diff with itself", []string{"diff", "--source", "twilio-sample.json", "--source-format", "Twilio",
+			"--target", "twilio-sample.json", "--target-format", "Twilio"}, exitOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, summary := runCLIForTest(t, tt.args...)
+			if code != tt.want || summary.ExitCode != tt.want {
+				t.Errorf("exit code = %d (summary %d), want %d: %s", code, summary.ExitCode, tt.want, summary.Error)
+			}
+			if summary.Success != (tt.want == exitOK) {
+				t.Errorf("success = %t with exit code %d", summary.Success, tt.want)
+			}
+			if tt.want == exitUsage && summary.Error == "" {
+				t.Error("usage error not reported in the summary")
+			}
+		})
+	}
+}
+
+func TestDiffCommandReadsEnhancedTarget(t *testing.T) {
+	dir := t.TempDir()
+	converted, err := convertBetween("Twilio", "RingCentral", mustReadFile(t, "twilio-sample.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enhanced := filepath.Join(dir, "enhanced.json")
+	output := `{"migration_metadata": {"source_format": "Twilio"}, "converted_data": ` + string(converted) + `}`
+	if err := ioutil.WriteFile(enhanced, []byte(output), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, summary := runCLIForTest(t, "diff", "--source", "twilio-sample.json", "--source-format", "Twilio",
+		"--target", enhanced, "--target-format", "RingCentral")
+	if code != exitOK {
+		t.Errorf("diff of the enhanced output exited %d: %s", code, summary.Error)
+	}
+	if result, _ := summary.Result.(map[string]interface{}); result["differences"] == nil {
+		t.Errorf("differences = %v, want []", result["differences"])
+	}
+
+	// The Twilio sample is not a RingCentral export, which would otherwise
+	// diff as every user and number removed
+	code, summary = runCLIForTest(t, "diff", "--source", "twilio-sample.json", "--source-format", "Twilio",
+		"--target", "twilio-sample.json", "--target-format", "RingCentral")
+	if code != exitCheckFailed || summary.Error == "" {
+		t.Errorf("diff against the wrong format exited %d: %q", code, summary.Error)
+	}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestPlanCommandWarnsOfFallback(t *testing.T) {
+	t.Setenv("ENGINE_ROOM_FIXTURES", "")
+	code, summary := runCLIForTest(t, "plan", "--ai", "--provider", "replay",
+		"--source", "twilio-sample.json", "--source-format", "Twilio", "--target-format", "RingCentral")
+	if code != exitOK {
+		t.Fatalf("plan exited %d: %s", code, summary.Error)
+	}
+	if !strings.Contains(summary.Warning, "offline planner") {
+		t.Errorf("warning = %q", summary.Warning)
+	}
+
+	code, summary = runCLIForTest(t, "plan", "--source", "twilio-sample.json", "--source-format", "Twilio")
+	if code != exitOK || summary.Warning != "" {
+		t.Errorf("offline plan: exit %d, warning %q", code, summary.Warning)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A single field-level difference between two canonical phone systems
+type SystemDifference struct {
+	Kind   string `json:"kind"` // "user" or "number"
+	ID     string `json:"id"`
+	Change string `json:"change"` // "added", "removed" or "changed"
+	Field  string `json:"field,omitempty"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+func (d SystemDifference) String() string {
+	switch d.Change {
+	case "added":
+		return fmt.Sprintf("%s %s added", d.Kind, d.ID)
+	case "removed":
+		return fmt.Sprintf("%s %s removed", d.Kind, d.ID)
+	default:
+		return fmt.Sprintf("%s %s %s: %q -> %q", d.Kind, d.ID, d.Field, d.Before, d.After)
+	}
+}
+
+// diffSystems compares two canonical systems by user and number ID and
+// returns every field that was added, removed or altered. Duplicate IDs are
+// paired by occurrence and reported as "ID#2", "ID#3" and so on.
+func diffSystems(before, after *CanonicalPhoneSystem) []SystemDifference {
+	var diffs []SystemDifference
+
+	beforeUsers := make(map[string]CanonicalUser)
+	beforeUserKeys := occurrenceKeys(len(before.Users), func(i int) string { return before.Users[i].ID })
+	for i, key := range beforeUserKeys {
+		beforeUsers[key] = before.Users[i]
+	}
+	afterUsers := make(map[string]CanonicalUser)
+	afterUserKeys := occurrenceKeys(len(after.Users), func(i int) string { return after.Users[i].ID })
+	for i, key := range afterUserKeys {
+		afterUsers[key] = after.Users[i]
+	}
+
+	for _, key := range beforeUserKeys {
+		user := beforeUsers[key]
+		other, ok := afterUsers[key]
+		if !ok {
+			diffs = append(diffs, SystemDifference{Kind: "user", ID: key, Change: "removed"})
+			continue
+		}
+		diffs = append(diffs, diffFields("user", key, [][3]string{
+			{"name", user.Name, other.Name},
+			{"email", user.Email, other.Email},
+			{"phone_number", user.PhoneNumber, other.PhoneNumber},
+			{"status", user.Status, other.Status},
+		})...)
+	}
+	for _, key := range afterUserKeys {
+		if _, ok := beforeUsers[key]; !ok {
+			diffs = append(diffs, SystemDifference{Kind: "user", ID: key, Change: "added"})
+		}
+	}
+
+	beforeNumbers := make(map[string]CanonicalNumber)
+	beforeNumberKeys := occurrenceKeys(len(before.Numbers), func(i int) string { return before.Numbers[i].ID })
+	for i, key := range beforeNumberKeys {
+		beforeNumbers[key] = before.Numbers[i]
+	}
+	afterNumbers := make(map[string]CanonicalNumber)
+	afterNumberKeys := occurrenceKeys(len(after.Numbers), func(i int) string { return after.Numbers[i].ID })
+	for i, key := range afterNumberKeys {
+		afterNumbers[key] = after.Numbers[i]
+	}
+
+	for _, key := range beforeNumberKeys {
+		number := beforeNumbers[key]
+		other, ok := afterNumbers[key]
+		if !ok {
+			diffs = append(diffs, SystemDifference{Kind: "number", ID: key, Change: "removed"})
+			continue
+		}
+		diffs = append(diffs, diffFields("number", key, [][3]string{
+			{"phone_number", number.Number, other.Number},
+			{"location", number.Location, other.Location},
+		})...)
+		diffs = append(diffs, diffCapabilities(key, number.Capabilities, other.Capabilities)...)
+	}
+	for _, key := range afterNumberKeys {
+		if _, ok := beforeNumbers[key]; !ok {
+			diffs = append(diffs, SystemDifference{Kind: "number", ID: key, Change: "added"})
+		}
+	}
+
+	return diffs
+}
+
+// occurrenceKeys returns the ID of each of the n records, suffixed with its
+// occurrence number when the ID repeats.
+func occurrenceKeys(n int, id func(i int) string) []string {
+	seen := make(map[string]int)
+	keys := make([]string, n)
+	for i := 0; i < n; i++ {
+		seen[id(i)]++
+		keys[i] = id(i)
+		if count := seen[id(i)]; count > 1 {
+			keys[i] = fmt.Sprintf("%s#%d", id(i), count)
+		}
+	}
+	return keys
+}
+
+func diffFields(kind, id string, fields [][3]string) []SystemDifference {
+	var diffs []SystemDifference
+	for _, field := range fields {
+		if field[1] != field[2] {
+			diffs = append(diffs, SystemDifference{
+				Kind:   kind,
+				ID:     id,
+				Change: "changed",
+				Field:  field[0],
+				Before: field[1],
+				After:  field[2],
+			})
+		}
+	}
+	return diffs
+}
+
+// diffCapabilities treats a missing capability as disabled, since exports
+// differ in whether they list disabled capabilities at all. A capability
+// that is lost in conversion still shows up as true → false.
+func diffCapabilities(id string, before, after map[string]bool) []SystemDifference {
+	names := make(map[string]bool)
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var fields [][3]string
+	for _, name := range sorted {
+		fields = append(fields, [3]string{
+			"capabilities." + name,
+			capabilityValue(before, name),
+			capabilityValue(after, name),
+		})
+	}
+	return diffFields("number", id, fields)
+}
+
+func capabilityValue(capabilities map[string]bool, name string) string {
+	return fmt.Sprintf("%t", capabilities[name])
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSystems(t *testing.T) {
+	user := CanonicalUser{ID: "u1", Name: "John Doe", Email: "john@example.com", PhoneNumber: "+15551230001", Status: "active"}
+	number := func(capabilities map[string]bool) CanonicalNumber {
+		return CanonicalNumber{ID: "n1", Number: "+15551230001", Capabilities: capabilities}
+	}
+
+	tests := []struct {
+		name          string
+		before, after CanonicalPhoneSystem
+		want          []string
+	}{
+		{
+			name:   "identical",
+			before: CanonicalPhoneSystem{Users: []CanonicalUser{user}},
+			after:  CanonicalPhoneSystem{Users: []CanonicalUser{user}},
+		},
+		{
+			name:   "missing capability equals disabled",
+			before: CanonicalPhoneSystem{Numbers: []CanonicalNumber{number(map[string]bool{"voice": true})}},
+			after:  CanonicalPhoneSystem{Numbers: []CanonicalNumber{number(map[string]bool{"voice": true, "fax": false, "voicemail": false})}},
+		},
+		{
+			name:   "lost capability",
+			before: CanonicalPhoneSystem{Numbers: []CanonicalNumber{number(map[string]bool{"voice": true, "conferencing": true})}},
+			after:  CanonicalPhoneSystem{Numbers: []CanonicalNumber{number(map[string]bool{"voice": true})}},
+			want:   []string{`number n1 capabilities.conferencing: "true" -> "false"`},
+		},
+		{
+			name:   "changed, removed and added records",
+			before: CanonicalPhoneSystem{Users: []CanonicalUser{user, {ID: "u2"}}},
+			after:  CanonicalPhoneSystem{Users: []CanonicalUser{{ID: "u1", Name: "John Doe", Email: "john@example.com", PhoneNumber: "+15551230001", Status: "inactive"}, {ID: "u3"}}},
+			want: []string{
+				`user u1 status: "active" -> "inactive"`,
+				"user u2 removed",
+				"user u3 added",
+			},
+		},
+		{
+			name:   "duplicate IDs pair by occurrence",
+			before: CanonicalPhoneSystem{Users: []CanonicalUser{{ID: "u1"}, {ID: "u1"}}},
+			after:  CanonicalPhoneSystem{Users: []CanonicalUser{{ID: "u1"}}},
+			want:   []string{"user u1#2 removed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, diff := range diffSystems(&tt.before, &tt.after) {
+				got = append(got, diff.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffSystems = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Executor names a TodoItem can be bound to
+const (
+	executorBackup         = "backup"
+	executorValidate       = "validate"
+	executorOrder          = "order"
+	executorConvertUsers   = "convert_users"
+	executorConvertNumbers = "convert_numbers"
+	executorVerify         = "verify"
+	executorRoundTrip      = "roundtrip"
+	executorWrite          = "write"
+	executorManual         = "manual" // no automated action, the user acknowledges the step
+)
+
+// StepExecutor performs the real work behind one TodoItem and returns a
+// description of what it did.
+type StepExecutor func(run *migrationRun, todo TodoItem) (string, error)
+
+var stepExecutors = map[string]StepExecutor{
+	executorBackup:         backupStep,
+	executorValidate:       validateStep,
+	executorOrder:          orderUsersStep,
+	executorConvertUsers:   convertUsersStep,
+	executorConvertNumbers: convertNumbersStep,
+	executorVerify:         verifyOutputStep,
+	executorRoundTrip:      roundTripStep,
+	executorWrite:          writeOutputStep,
+}
+
+// Keywords used to bind TodoItems that don't name an executor, checked in
+// order against the description and then the action
+var stepExecutorKeywords = []struct {
+	executor string
+	keywords []string
+}{
+	{executorBackup, []string{"backup", "back up", "snapshot"}},
+	{executorRoundTrip, []string{"round trip", "round-trip", "reversib"}},
+	{executorVerify, []string{"post-migration", "verify", "verification"}},
+	{executorValidate, []string{"validat", "integrity", "data quality"}},
+	{executorOrder, []string{"priority order", "recommended order", "ordering"}},
+	{executorConvertNumbers, []string{"migrate phone", "migrate number", "number migration", "convert number", "capabilit"}},
+	{executorConvertUsers, []string{"migrate user", "user migration", "convert user", "migrate account", "user account"}},
+	{executorWrite, []string{"write", "output file", "migration file"}},
+}
+
+// resolveStepExecutor picks the executor for a TodoItem, falling back to
+// manual when nothing matches.
+func resolveStepExecutor(todo TodoItem) string {
+	if _, ok := stepExecutors[todo.Executor]; ok {
+		return todo.Executor
+	}
+	for _, text := range []string{todo.Description, todo.Action} {
+		text = strings.ToLower(text)
+		for _, entry := range stepExecutorKeywords {
+			for _, keyword := range entry.keywords {
+				if strings.Contains(text, keyword) {
+					return entry.executor
+				}
+			}
+		}
+	}
+	return executorManual
+}
+
+// State shared by the step executors of one step-by-step migration
+type migrationRun struct {
+	config     MigrationConfig
+	plan       *MigrationPlan
+	sourceData []byte
+	source     *CanonicalPhoneSystem
+	ordered    []CanonicalUser
+	converted  *CanonicalPhoneSystem
+	validation *ValidationReport
+	roundTrip  *RoundTripReport
+	backupFile string
+	written    []writtenFile // files to restore if the run is aborted
+	skipped    []SkippedStep
+}
+
+func newMigrationRun(config MigrationConfig, plan *MigrationPlan) *migrationRun {
+	return &migrationRun{
+		config:    config,
+		plan:      plan,
+		converted: &CanonicalPhoneSystem{},
+	}
+}
+
+func (r *migrationRun) loadSource() error {
+	if r.source != nil {
+		return nil
+	}
+
+	sourceData, err := ioutil.ReadFile(r.config.SourceFile)
+	if err != nil {
+		return fmt.Errorf("failed to read source file: %w", err)
+	}
+	adapter, err := GetAdapter(r.config.SourceFormat)
+	if err != nil {
+		return err
+	}
+	source, err := adapter.Decode(sourceData)
+	if err != nil {
+		return fmt.Errorf("failed to parse source data: %w", err)
+	}
+
+	r.sourceData = sourceData
+	r.source = source
+	return nil
+}
+
+// forgetSource drops the source data and everything derived from it, so a
+// retried step reads the source file again.
+func (r *migrationRun) forgetSource() {
+	r.sourceData = nil
+	r.source = nil
+	r.validation = nil
+	r.ordered = nil
+	r.converted = &CanonicalPhoneSystem{}
+}
+
+func (r *migrationRun) validate() error {
+	if r.validation != nil {
+		return nil
+	}
+	if err := r.loadSource(); err != nil {
+		return err
+	}
+
+	report, err := ValidateSource(r.config.SourceFormat, r.sourceData)
+	if err != nil {
+		return err
+	}
+	r.validation = report
+	return nil
+}
+
+// orderUsers applies the plan's recommended order, reconciled against the
+// source records.
+func (r *migrationRun) orderUsers() error {
+	if r.ordered != nil {
+		return nil
+	}
+	if err := r.loadSource(); err != nil {
+		return err
+	}
+
+	r.ordered = reconcilePlan(r.plan, r.source.Users)
+	if r.ordered == nil {
+		r.ordered = []CanonicalUser{}
+	}
+	return nil
+}
+
+// ensureConverted runs any conversion the plan left out or the user skipped,
+// so verification and output always see complete data. It returns a note
+// for the step's details when it converted anything.
+func (r *migrationRun) ensureConverted() (string, error) {
+	var converted []string
+	if r.converted.Users == nil {
+		if _, err := convertUsersStep(r, TodoItem{}); err != nil {
+			return "", err
+		}
+		converted = append(converted, "users")
+	}
+	if r.converted.Numbers == nil {
+		if _, err := convertNumbersStep(r, TodoItem{}); err != nil {
+			return "", err
+		}
+		converted = append(converted, "numbers")
+	}
+	if len(converted) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf(" (converted the %s here, as no earlier step did)", strings.Join(converted, " and ")), nil
+}
+
+func (r *migrationRun) encodeTarget() ([]byte, error) {
+	adapter, err := GetAdapter(r.config.TargetFormat)
+	if err != nil {
+		return nil, err
+	}
+	return adapter.Encode(r.converted)
+}
+
+func backupStep(run *migrationRun, todo TodoItem) (string, error) {
+	if err := run.loadSource(); err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(run.config.SourceFile)
+	run.backupFile = fmt.Sprintf("%s.backup-%s%s",
+		strings.TrimSuffix(run.config.SourceFile, ext), time.Now().Format("20060102-150405"), ext)
+	if err := ioutil.WriteFile(run.backupFile, run.sourceData, 0644); err != nil {
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	return fmt.Sprintf("✓ Backed up %d bytes to %s", len(run.sourceData), run.backupFile), nil
+}
+
+func validateStep(run *migrationRun, todo TodoItem) (string, error) {
+	if err := run.validate(); err != nil {
+		return "", err
+	}
+
+	report := run.validation
+	if report.Users == 0 && report.Numbers == 0 {
+		return "", fmt.Errorf("no users or numbers found in %s data", run.config.SourceFormat)
+	}
+	if report.HasErrors() {
+		var messages []string
+		for _, finding := range report.Findings {
+			if finding.Severity == severityError && len(messages) < 3 {
+				messages = append(messages, fmt.Sprintf("%s %s: %s", finding.Kind, finding.ID, finding.Message))
+			}
+		}
+		return "", fmt.Errorf("validation failed (%s): %s", report.Summary(), strings.Join(messages, "; "))
+	}
+	if report.Warnings > 0 {
+		return "⚠ Validated " + report.Summary(), nil
+	}
+	return "✓ Validated " + report.Summary(), nil
+}
+
+func orderUsersStep(run *migrationRun, todo TodoItem) (string, error) {
+	if err := run.orderUsers(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("✓ Ordered %d users by plan priority (%d reconciliation finding(s))",
+		len(run.ordered), len(run.plan.Reconciliation)), nil
+}
+
+func convertUsersStep(run *migrationRun, todo TodoItem) (string, error) {
+	if err := run.orderUsers(); err != nil {
+		return "", err
+	}
+
+	run.converted.Users = append([]CanonicalUser{}, run.ordered...)
+	active := 0
+	for _, user := range run.converted.Users {
+		if user.IsActive() {
+			active++
+		}
+	}
+	details := fmt.Sprintf("✓ Converted %d users (%d active) to %s in priority order",
+		len(run.converted.Users), active, run.config.TargetFormat)
+	if excluded := len(run.plan.Excluded); excluded > 0 {
+		details += fmt.Sprintf(", %d excluded by plan edits", excluded)
+	}
+	return details, nil
+}
+
+func convertNumbersStep(run *migrationRun, todo TodoItem) (string, error) {
+	if err := run.loadSource(); err != nil {
+		return "", err
+	}
+
+	// Port numbers in the order of the plan's number plan when it has one
+	if run.plan != nil && len(run.plan.NumberPlan) > 0 {
+		run.converted.Numbers = reconcileNumberPlan(run.plan, run.source.Numbers, run.config.TargetFormat)
+	} else {
+		run.converted.Numbers = append([]CanonicalNumber{}, run.source.Numbers...)
+	}
+	capabilities := 0
+	for _, number := range run.converted.Numbers {
+		capabilities += len(enabledCapabilities(number))
+	}
+	if unmapped := unmappedCapabilities(run.source, run.config.TargetFormat); len(unmapped) > 0 {
+		return fmt.Sprintf("⚠ Converted %d phone numbers to %s - %d of %d enabled capabilities have no %s equivalent",
+			len(run.converted.Numbers), run.config.TargetFormat, len(unmapped), capabilities, run.config.TargetFormat), nil
+	}
+	return fmt.Sprintf("✓ Converted %d phone numbers with %d enabled capabilities to %s",
+		len(run.converted.Numbers), capabilities, run.config.TargetFormat), nil
+}
+
+func verifyOutputStep(run *migrationRun, todo TodoItem) (string, error) {
+	note, err := run.ensureConverted()
+	if err != nil {
+		return "", err
+	}
+
+	targetData, err := run.encodeTarget()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s output: %w", run.config.TargetFormat, err)
+	}
+	adapter, _ := GetAdapter(run.config.TargetFormat)
+	decoded, err := adapter.Decode(targetData)
+	if err != nil {
+		return "", fmt.Errorf("converted %s output does not parse: %w", run.config.TargetFormat, err)
+	}
+
+	// Users excluded while editing the plan are meant to be missing
+	expected := *run.source
+	if excluded := run.plan.excludedIDs(); len(excluded) > 0 {
+		expected.Users = nil
+		for _, user := range run.source.Users {
+			if !excluded[user.ID] {
+				expected.Users = append(expected.Users, user)
+			}
+		}
+	}
+
+	for _, diff := range diffSystems(&expected, decoded) {
+		if diff.Change == "removed" {
+			return "", fmt.Errorf("verification failed: %s", diff)
+		}
+	}
+	return fmt.Sprintf("✓ Verified all %d planned users and %d numbers are present in the %s output%s",
+		len(decoded.Users), len(decoded.Numbers), run.config.TargetFormat, note), nil
+}
+
+func roundTripStep(run *migrationRun, todo TodoItem) (string, error) {
+	if err := run.loadSource(); err != nil {
+		return "", err
+	}
+
+	report, err := checkRoundTrip(run.config.SourceFormat, run.config.TargetFormat, run.sourceData)
+	if err != nil {
+		return "", err
+	}
+	run.roundTrip = report
+
+	if !report.Lossless {
+		return "⚠ " + report.Summary(), nil
+	}
+	return "✓ " + report.Summary(), nil
+}
+
+func writeOutputStep(run *migrationRun, todo TodoItem) (string, error) {
+	note, err := run.ensureConverted()
+	if err != nil {
+		return "", err
+	}
+	if err := run.validate(); err != nil {
+		return "", err
+	}
+
+	targetData, err := run.encodeTarget()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s output: %w", run.config.TargetFormat, err)
+	}
+	rollback, err := newRollbackRecord(run.config, run.sourceData, targetData)
+	if err != nil {
+		return "", err
+	}
+
+	metadata := map[string]interface{}{
+		"enhanced_by":           run.plan.GeneratedBy,
+		"migration_time":        time.Now().Format("2006-01-02 15:04:05"),
+		"source_format":         run.config.SourceFormat,
+		"target_format":         run.config.TargetFormat,
+		"execution_mode":        "step-by-step",
+		"reconciliation":        run.plan.Reconciliation,
+		"backup_file":           run.backupFile,
+		"unmapped_capabilities": unmappedCapabilities(run.source, run.config.TargetFormat),
+		"round_trip":            run.roundTrip,
+		"skipped_steps":         run.skipped,
+	}
+	if run.plan.GeneratedBy == planGeneratorEngineRoom {
+		// The policy was checked when the plan was generated
+		redaction, _ := parseRedactionPolicy(run.config.LLM.Redaction)
+		metadata["redaction"] = redaction.Describe()
+		metadata["redaction_key_id"] = run.plan.RedactionKeyID
+		metadata["engine_room_usage"] = run.plan.Usage
+	}
+
+	// Create enhanced output with the plan's insights
+	enhancedOutput := map[string]interface{}{
+		"migration_plan":     run.plan,
+		"validation_report":  run.validation,
+		"original_data":      json.RawMessage(run.sourceData),
+		"converted_data":     json.RawMessage(targetData),
+		"rollback":           rollback,
+		"migration_metadata": metadata,
+	}
+
+	output, err := json.MarshalIndent(enhancedOutput, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal output: %w", err)
+	}
+	if err := run.writeFile(run.config.TargetFile, output); err != nil {
+		return "", fmt.Errorf("failed to write target file: %w", err)
+	}
+
+	return fmt.Sprintf("✓ Wrote %d bytes to %s%s", len(output), run.config.TargetFile, note), nil
+}
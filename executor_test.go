@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveStepExecutor(t *testing.T) {
+	tests := []struct {
+		todo TodoItem
+		want string
+	}{
+		{TodoItem{Executor: executorWrite, Description: "Backup current system data"}, executorWrite},
+		{TodoItem{Executor: "teleport", Description: "Backup current system data"}, executorBackup},
+		{TodoItem{Description: "Post-migration validation"}, executorVerify},
+		{TodoItem{Description: "Validate data integrity"}, executorValidate},
+		{TodoItem{Description: "Migrate phone numbers and capabilities"}, executorConvertNumbers},
+		{TodoItem{Description: "Step four", Action: "Migrate user accounts"}, executorConvertUsers},
+		{TodoItem{Description: "Notify staff of the cutover window"}, executorManual},
+	}
+	for _, tt := range tests {
+		if got := resolveStepExecutor(tt.todo); got != tt.want {
+			t.Errorf("resolveStepExecutor(%+v) = %q, want %q", tt.todo, got, tt.want)
+		}
+	}
+}
+
+// newTestRun copies the sample export into a scratch directory so backups
+// and output land there.
+func newTestRun(t *testing.T, targetFormat string) *migrationRun {
+	t.Helper()
+	dir := t.TempDir()
+	data, err := ioutil.ReadFile("twilio-sample.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "twilio.json")
+	if err := ioutil.WriteFile(source, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := MigrationConfig{
+		SourceFile:   source,
+		SourceFormat: "Twilio",
+		TargetFile:   filepath.Join(dir, "out.json"),
+		TargetFormat: targetFormat,
+	}
+	return newMigrationRun(config, &MigrationPlan{GeneratedBy: planGeneratorOffline})
+}
+
+func TestStepExecutorsRunPlan(t *testing.T) {
+	run := newTestRun(t, "RingCentral")
+
+	// Verify and write fill in conversions the plan never asked for
+	details := make(map[string]string)
+	for _, name := range []string{executorBackup, executorValidate, executorVerify, executorWrite} {
+		var err error
+		if details[name], err = stepExecutors[name](run, TodoItem{}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if !strings.HasSuffix(details[executorVerify], "(converted the users and numbers here, as no earlier step did)") {
+		t.Errorf("verify details = %q", details[executorVerify])
+	}
+	if strings.Contains(details[executorWrite], "converted") {
+		t.Errorf("write details = %q", details[executorWrite])
+	}
+
+	backup, err := ioutil.ReadFile(run.backupFile)
+	if err != nil || string(backup) != string(run.sourceData) {
+		t.Errorf("backup %s does not match the source: %v", run.backupFile, err)
+	}
+	if len(run.converted.Users) != len(run.source.Users) || len(run.converted.Numbers) != len(run.source.Numbers) {
+		t.Errorf("converted %d users and %d numbers, source has %d and %d",
+			len(run.converted.Users), len(run.converted.Numbers), len(run.source.Users), len(run.source.Numbers))
+	}
+
+	var output struct {
+		ConvertedData RingCentralPhoneSystem `json:"converted_data"`
+		Metadata      map[string]interface{} `json:"migration_metadata"`
+	}
+	data, err := ioutil.ReadFile(run.config.TargetFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &output); err != nil {
+		t.Fatal(err)
+	}
+	if len(output.ConvertedData.Accounts) != len(run.source.Users) {
+		t.Errorf("output has %d accounts, want %d", len(output.ConvertedData.Accounts), len(run.source.Users))
+	}
+	if output.Metadata["backup_file"] != run.backupFile || output.Metadata["execution_mode"] != "step-by-step" {
+		t.Errorf("metadata = %v", output.Metadata)
+	}
+}
+
+func TestValidateStepRejectsEmptySource(t *testing.T) {
+	run := newTestRun(t, "RingCentral")
+	if err := ioutil.WriteFile(run.config.SourceFile, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := validateStep(run, TodoItem{}); err == nil {
+		t.Error("validate accepted an empty export")
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Engine Room AI backend configuration. Zero values fall back to the
+// provider's defaults.
+type LLMConfig struct {
+	Provider    string        `json:"provider"`
+	Model       string        `json:"model"`
+	MaxTokens   int           `json:"max_tokens"`
+	BaseURL     string        `json:"base_url"`
+	Timeout     time.Duration `json:"timeout"`
+	APIKey      string        `json:"-"`
+	FixtureFile string        `json:"fixture_file,omitempty"`
+	RecordFile  string        `json:"record_file,omitempty"` // JSONL exchange log, empty to disable
+	MaxAttempts int           `json:"max_attempts"`
+	Redaction   string        `json:"redaction"`  // redaction policy, see parseRedactionPolicy
+	Budget      float64       `json:"budget_usd"` // estimated cost limit in US dollars, zero for none
+	ChunkSize   int           `json:"chunk_size"` // users or numbers planned per call, zero for the default
+}
+
+// Provider names accepted in LLMConfig.Provider
+const (
+	providerAnthropic = "anthropic"
+	providerOpenAI    = "openai"
+	providerReplay    = "replay"
+)
+
+const (
+	defaultMaxTokens  = 4000
+	defaultLLMTimeout = 30 * time.Second
+)
+
+// Model used by each provider when LLMConfig.Model is empty
+var defaultLLMModels = map[string]string{
+	providerAnthropic: "claude-3-sonnet-20240229",
+	providerOpenAI:    "gpt-4o-mini",
+}
+
+// LLMProvider sends a conversation to a language model and returns its reply.
+type LLMProvider interface {
+	Name() string
+	Complete(ctx context.Context, messages []EngineRoomMessage) (*LLMResponse, error)
+}
+
+type LLMResponse struct {
+	Text  string
+	Model string
+	Usage EngineRoomUsage
+}
+
+// Provider registry, keyed by LLMConfig.Provider
+var llmProviders = map[string]func(config LLMConfig) (LLMProvider, error){
+	providerAnthropic: newAnthropicProvider,
+	providerOpenAI:    newOpenAIProvider,
+	providerReplay:    newReplayProvider,
+}
+
+// llmConfigFromEnv reads the backend configuration from ENGINE_ROOM_*
+// environment variables, defaulting to the Anthropic API.
+func llmConfigFromEnv() LLMConfig {
+	config := LLMConfig{
+		Provider:    os.Getenv("ENGINE_ROOM_PROVIDER"),
+		Model:       os.Getenv("ENGINE_ROOM_MODEL"),
+		BaseURL:     os.Getenv("ENGINE_ROOM_BASE_URL"),
+		FixtureFile: os.Getenv("ENGINE_ROOM_FIXTURES"),
+		Redaction:   os.Getenv(redactionPolicyEnv),
+	}
+	if config.Provider == "" {
+		config.Provider = providerAnthropic
+	}
+	config.RecordFile = defaultRecordFile
+	if record, ok := os.LookupEnv("ENGINE_ROOM_RECORD"); ok {
+		config.RecordFile = record
+		if record == "off" {
+			config.RecordFile = ""
+		}
+	}
+	if maxTokens, err := strconv.Atoi(os.Getenv("ENGINE_ROOM_MAX_TOKENS")); err == nil {
+		config.MaxTokens = maxTokens
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("ENGINE_ROOM_TIMEOUT")); err == nil {
+		config.Timeout = timeout
+	}
+	if attempts, err := strconv.Atoi(os.Getenv("ENGINE_ROOM_MAX_ATTEMPTS")); err == nil {
+		config.MaxAttempts = attempts
+	}
+	if budget, err := strconv.ParseFloat(os.Getenv("ENGINE_ROOM_BUDGET"), 64); err == nil {
+		config.Budget = budget
+	}
+	if chunkSize, err := strconv.Atoi(os.Getenv("ENGINE_ROOM_CHUNK_SIZE")); err == nil {
+		config.ChunkSize = chunkSize
+	}
+
+	config.APIKey = llmAPIKey(config.Provider)
+	return config
+}
+
+// llmAPIKey reads the API key for the provider from its usual environment
+// variable.
+func llmAPIKey(provider string) string {
+	switch provider {
+	case providerAnthropic:
+		return os.Getenv("ANTHROPIC_API_KEY")
+	case providerOpenAI:
+		return os.Getenv("OPENAI_API_KEY")
+	}
+	return ""
+}
+
+// Check reports why the configuration cannot be used, or nil if it can.
+func (c LLMConfig) Check() error {
+	if _, err := parseRedactionPolicy(c.Redaction); err != nil {
+		return err
+	}
+
+	switch c.Provider {
+	case providerAnthropic:
+		if c.APIKey == "" {
+			return fmt.Errorf("ANTHROPIC_API_KEY environment variable not set")
+		}
+	case providerOpenAI:
+		if c.APIKey == "" && c.BaseURL == "" {
+			return fmt.Errorf("OPENAI_API_KEY environment variable not set and no ENGINE_ROOM_BASE_URL for a local server")
+		}
+	case providerReplay:
+		if c.FixtureFile == "" {
+			return fmt.Errorf("replay provider needs a fixture file or exchange log (ENGINE_ROOM_FIXTURES)")
+		}
+	default:
+		return fmt.Errorf("unknown Engine Room AI provider: %s", c.Provider)
+	}
+	return nil
+}
+
+func (c LLMConfig) model() string {
+	if c.Model != "" {
+		return c.Model
+	}
+	return defaultLLMModels[c.Provider]
+}
+
+func (c LLMConfig) maxTokens() int {
+	if c.MaxTokens > 0 {
+		return c.MaxTokens
+	}
+	return defaultMaxTokens
+}
+
+func (c LLMConfig) httpClient() *http.Client {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultLLMTimeout
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+func newLLMProvider(config LLMConfig) (LLMProvider, error) {
+	if err := config.Check(); err != nil {
+		return nil, err
+	}
+	provider, err := llmProviders[config.Provider](config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replayed exchanges are already in a log, so only live calls are
+	// recorded and retried. Every attempt is recorded.
+	if config.Provider != providerReplay {
+		if config.RecordFile != "" {
+			redaction, _ := parseRedactionPolicy(config.Redaction)
+			keyID, err := redactionKeyID(redaction)
+			if err != nil {
+				return nil, err
+			}
+			provider = &recordingProvider{inner: provider, model: config.model(), keyID: keyID, path: config.RecordFile}
+		}
+		policy := defaultRetryPolicy
+		if config.MaxAttempts > 0 {
+			policy.MaxAttempts = config.MaxAttempts
+		}
+		provider = newRetryingProvider(provider, policy)
+	}
+	return provider, nil
+}
+
+// Anthropic Messages API
+type anthropicProvider struct {
+	config     LLMConfig
+	httpClient *http.Client
+}
+
+func newAnthropicProvider(config LLMConfig) (LLMProvider, error) {
+	config.Model = config.model()
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.anthropic.com"
+	}
+	return &anthropicProvider{config: config, httpClient: config.httpClient()}, nil
+}
+
+func (p *anthropicProvider) Name() string { return providerAnthropic }
+
+func (p *anthropicProvider) Complete(ctx context.Context, messages []EngineRoomMessage) (*LLMResponse, error) {
+	request := EngineRoomRequest{
+		Model:     p.config.Model,
+		MaxTokens: p.config.maxTokens(),
+		Messages:  messages,
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(p.config.BaseURL, "/")+"/v1/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.config.APIKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	body, err := doLLMRequest(p.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var engineRoomResp EngineRoomResponse
+	if err := json.Unmarshal(body, &engineRoomResp); err != nil {
+		return nil, err
+	}
+
+	if len(engineRoomResp.Content) == 0 {
+		return nil, fmt.Errorf("no content in Engine Room AI response")
+	}
+
+	return &LLMResponse{
+		Text:  engineRoomResp.Content[0].Text,
+		Model: p.config.Model,
+		Usage: engineRoomResp.Usage,
+	}, nil
+}
+
+// OpenAI-compatible chat completions API, also served by most local model
+// servers
+type openAIProvider struct {
+	config     LLMConfig
+	httpClient *http.Client
+}
+
+type openAIRequest struct {
+	Model     string              `json:"model"`
+	MaxTokens int                 `json:"max_tokens"`
+	Messages  []EngineRoomMessage `json:"messages"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message EngineRoomMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func newOpenAIProvider(config LLMConfig) (LLMProvider, error) {
+	config.Model = config.model()
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.openai.com/v1"
+	}
+	return &openAIProvider{config: config, httpClient: config.httpClient()}, nil
+}
+
+func (p *openAIProvider) Name() string { return providerOpenAI }
+
+func (p *openAIProvider) Complete(ctx context.Context, messages []EngineRoomMessage) (*LLMResponse, error) {
+	jsonData, err := json.Marshal(openAIRequest{
+		Model:     p.config.Model,
+		MaxTokens: p.config.maxTokens(),
+		Messages:  messages,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(p.config.BaseURL, "/")+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if p.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.config.APIKey)
+	}
+
+	body, err := doLLMRequest(p.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var openAIResp openAIResponse
+	if err := json.Unmarshal(body, &openAIResp); err != nil {
+		return nil, err
+	}
+
+	if len(openAIResp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in Engine Room AI response")
+	}
+
+	return &LLMResponse{
+		Text:  openAIResp.Choices[0].Message.Content,
+		Model: p.config.Model,
+		Usage: EngineRoomUsage{
+			InputTokens:  openAIResp.Usage.PromptTokens,
+			OutputTokens: openAIResp.Usage.CompletionTokens,
+		},
+	}, nil
+}
+
+func doLLMRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		if req.Context().Err() != nil {
+			return nil, req.Context().Err()
+		}
+		return nil, &EngineRoomAPIError{Kind: apiErrorNetwork, Message: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &EngineRoomAPIError{Kind: apiErrorNetwork, Message: err.Error()}
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, classifyHTTPError(resp, body)
+	}
+	return body, nil
+}
+
+// Fixture replay, serving responses without any network access. A .jsonl
+// fixture is an exchange log and responses are looked up by prompt hash;
+// anything else is a JSON array of response texts served in order.
+type replayProvider struct {
+	responses []string
+	next      int
+	exchanges map[string]EngineRoomExchange
+}
+
+func newReplayProvider(config LLMConfig) (LLMProvider, error) {
+	if strings.HasSuffix(config.FixtureFile, ".jsonl") {
+		exchanges, err := loadExchangeLog(config.FixtureFile)
+		if err != nil {
+			return nil, err
+		}
+		redaction, _ := parseRedactionPolicy(config.Redaction) // checked by newLLMProvider
+		if err := checkReplayKey(redaction, exchanges); err != nil {
+			return nil, err
+		}
+		return &replayProvider{exchanges: exchanges}, nil
+	}
+
+	data, err := ioutil.ReadFile(config.FixtureFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture file: %w", err)
+	}
+
+	var responses []string
+	if err := json.Unmarshal(data, &responses); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture file: %w", err)
+	}
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("fixture file %s has no responses", config.FixtureFile)
+	}
+	return &replayProvider{responses: responses}, nil
+}
+
+func (p *replayProvider) Name() string { return providerReplay }
+
+func (p *replayProvider) Complete(ctx context.Context, messages []EngineRoomMessage) (*LLMResponse, error) {
+	if p.exchanges != nil {
+		hash := promptHash(messages)
+		exchange, ok := p.exchanges[hash]
+		if !ok {
+			return nil, fmt.Errorf("no recorded response for prompt hash %s", hash)
+		}
+		return &LLMResponse{Text: exchange.Response, Model: exchange.Model, Usage: exchange.Usage}, nil
+	}
+
+	if p.next >= len(p.responses) {
+		return nil, fmt.Errorf("fixture file has no response left for request %d", p.next+1)
+	}
+	text := p.responses[p.next]
+	p.next++
+	return &LLMResponse{Text: text, Model: providerReplay}, nil
+}
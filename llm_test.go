@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLLMConfigCheck(t *testing.T) {
+	tests := []struct {
+		config LLMConfig
+		ok     bool
+	}{
+		{LLMConfig{Provider: providerAnthropic}, false},
+		{LLMConfig{Provider: providerAnthropic, APIKey: "key"}, true},
+		{LLMConfig{Provider: providerOpenAI}, false},
+		{LLMConfig{Provider: providerOpenAI, BaseURL: "http://localhost:11434/v1"}, true},
+		{LLMConfig{Provider: providerReplay}, false},
+		{LLMConfig{Provider: providerReplay, FixtureFile: "fixtures.json"}, true},
+		{LLMConfig{Provider: "carrier-pigeon", APIKey: "key"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Check(); (err == nil) != tt.ok {
+			t.Errorf("Check(%+v) = %v, want ok=%t", tt.config, err, tt.ok)
+		}
+	}
+}
+
+func TestAnthropicProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "secret" {
+			http.Error(w, "bad request to "+r.URL.Path, http.StatusBadRequest)
+			return
+		}
+		var request EngineRoomRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		if request.Model != "claude-test" || request.MaxTokens != defaultMaxTokens {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"content": [{"type": "text", "text": "hello"}], "usage": {"input_tokens": 12, "output_tokens": 3}}`))
+	}))
+	defer server.Close()
+
+	provider, err := newLLMProvider(LLMConfig{Provider: providerAnthropic, APIKey: "secret", Model: "claude-test", BaseURL: server.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := provider.Complete(context.Background(), []EngineRoomMessage{{Role: "user", Content: "hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "hello" || resp.Model != "claude-test" || resp.Usage.InputTokens != 12 || resp.Usage.OutputTokens != 3 {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestOpenAIProviderWithoutKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			http.Error(w, "unexpected Authorization header", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/v1/chat/completions" {
+			w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "local"}}], "usage": {"prompt_tokens": 5, "completion_tokens": 1}}`))
+			return
+		}
+		http.Error(w, "model not loaded", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	provider, err := newLLMProvider(LLMConfig{Provider: providerOpenAI, BaseURL: server.URL + "/v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := provider.Complete(context.Background(), []EngineRoomMessage{{Role: "user", Content: "hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "local" || resp.Model != "gpt-4o-mini" || resp.Usage.InputTokens != 5 {
+		t.Errorf("response = %+v", resp)
+	}
+
+	provider, _ = newLLMProvider(LLMConfig{Provider: providerOpenAI, BaseURL: server.URL})
+	if _, err := provider.Complete(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "model not loaded") {
+		t.Errorf("error = %v, want the server's message", err)
+	}
+}
+
+func TestReplayProvider(t *testing.T) {
+	fixtures := filepath.Join(t.TempDir(), "fixtures.json")
+	if err := ioutil.WriteFile(fixtures, []byte(`["first", "second"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := newLLMProvider(LLMConfig{Provider: providerReplay, FixtureFile: fixtures})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"first", "second"} {
+		resp, err := provider.Complete(context.Background(), nil)
+		if err != nil || resp.Text != want {
+			t.Fatalf("Complete = %+v, %v, want %q", resp, err, want)
+		}
+	}
+	if _, err := provider.Complete(context.Background(), nil); err == nil {
+		t.Error("replay served more responses than the fixture file holds")
+	}
+
+	if err := ioutil.WriteFile(fixtures, []byte(`[]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newLLMProvider(LLMConfig{Provider: providerReplay, FixtureFile: fixtures}); err == nil {
+		t.Error("empty fixture file accepted")
+	}
+}
@@ -1,18 +1,20 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/charmbracelet/bubbles/filepicker"
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -87,8 +89,11 @@ type EngineRoomUsage struct {
 
 // AI-enhanced migration types
 type EngineRoomEnhancedMigrator struct {
-	apiKey     string
-	httpClient *http.Client
+	provider   LLMProvider
+	usage      *meteredProvider // the provider, counting tokens and cost
+	redaction  RedactionPolicy  // applied to every user sent to Engine Room AI
+	chunkSize  int              // users or numbers planned per call
+	onProgress func(PlanProgress)
 }
 
 type MigrationPlan struct {
@@ -97,6 +102,15 @@ type MigrationPlan struct {
 	RiskAssessment   string                `json:"risk_assessment"`
 	TodoList         []TodoItem            `json:"todo_list"`
 	EstimatedTime    string                `json:"estimated_time"`
+	GeneratedBy      string                `json:"generated_by,omitempty"`
+	RedactionKeyID   string                `json:"redaction_key_id,omitempty"` // key of the hash tokens Engine Room AI saw, see redactionKeyID
+	Repairs          int                   `json:"repairs,omitempty"` // Engine Room AI repair round-trips needed
+	Usage            *UsageSummary         `json:"usage,omitempty"`   // Engine Room AI calls spent building the plan
+	NumberPlan       []NumberWithPriority  `json:"number_plan,omitempty"` // porting order of the phone numbers
+	Excluded         []AccountWithPriority `json:"excluded,omitempty"`    // users left out of the migration while editing
+	Edits            []PlanEdit            `json:"edits,omitempty"`       // changes made to the generated plan before approval
+	Revisions        []PlanRevision        `json:"revisions,omitempty"`   // changes Engine Room AI made on request, in order
+	Reconciliation   []PlanDiscrepancy     `json:"reconciliation,omitempty"`
 }
 
 type TodoItem struct {
@@ -105,30 +119,47 @@ type TodoItem struct {
 	Action      string `json:"action"`
 	Risk        string `json:"risk"`
 	Completed   bool   `json:"completed"`
+	Executor    string `json:"executor,omitempty"`
 }
 
 type ExecutionStep struct {
-	StepNumber  int
-	Description string
-	Status      string // "pending", "running", "completed", "failed"
-	Details     string
-	Error       error
+	StepNumber    int
+	Description   string
+	Action        string
+	Executor      string
+	Risk          string
+	Status        string // "pending", "approval", "running", "awaiting", "completed", "acknowledged", "failed", "skipped"
+	Details       string
+	Error         error
+	Approved      bool   // a high-risk step was approved to run
+	Justification string // why the step was skipped
 }
 
 type AccountWithPriority struct {
-	Account  TwilioUser `json:"account"`
+	Account  CanonicalUser `json:"account"`
 	Priority int        `json:"priority"`
 	Reason   string     `json:"reason"`
 	Risk     string     `json:"risk_level"`
 }
 
+type NumberWithPriority struct {
+	Number             CanonicalNumber `json:"number"`
+	Priority           int             `json:"priority"`
+	Reason             string          `json:"reason"`
+	Risk               string          `json:"risk_level"`
+	CapabilitiesAtRisk []string        `json:"capabilities_at_risk,omitempty"` // enabled but not expressible in the target
+}
+
 // Migration configuration
 type MigrationConfig struct {
-	SourceFile   string
-	TargetFile   string
-	SourceFormat string
-	TargetFormat string
-	UseAI        bool
+	SourceFile      string
+	TargetFile      string
+	SourceFormat    string
+	TargetFormat    string
+	UseAI           bool
+	LLM             LLMConfig
+	OfflinePlan     bool // plan with the rule-based OfflinePlanner instead of Engine Room AI
+	ApproveHighRisk bool // pause for approval before every high-risk step
 }
 
 // UI States
@@ -136,14 +167,17 @@ type state int
 
 const (
 	enteringSource state = iota
+	previewingSource
 	selectingSourceFormat
 	enteringTarget
 	selectingTargetFormat
 	askingAIPreference
 	showingPlan
 	confirmingPlan
+	editingPlan
 	executingPlan
 	completed
+	recovering // a failure, with ways to carry on
 )
 
 // Main model
@@ -151,6 +185,15 @@ type model struct {
 	state             state
 	spinner           spinner.Model
 	textInput         textinput.Model
+	filepicker        filepicker.Model // browses for the source file
+	typingPath        bool             // the source path is typed instead of picked
+	sourceErr         error            // why the chosen source file cannot be used
+	detectedFormat    string
+	detectErr         error
+	preview           *CanonicalPhoneSystem // parsed source, nil if the format is unknown
+	previewReport     *ValidationReport
+	userTable         table.Model
+	numberTable       table.Model
 	config            MigrationConfig
 	err               error
 	migrationDone     bool
@@ -161,9 +204,36 @@ type model struct {
 	selectedAI        int
 	aiOptions         []string
 	migrationPlan     *MigrationPlan
+	originalPlan      *MigrationPlan // the plan as generated or last revised, kept once it is edited
+	editSection       int            // editingUsers or editingSteps
+	editCursor        int
+	editPrompt        string // text being entered in the plan editor, if any
+	refinement        *planRefinement // chat about the plan, nil until the first instruction
+	chatting          bool            // the plan chat has the keyboard
+	chatPending       bool
+	chatLog           []chatTurn
+	lastChanges       []PlanEdit // made by the latest revision, highlighted in the plan
+	viewport          viewport.Model // scrolls the plan, the step list and the report
+	viewportState     state          // screen the viewport content was last rendered for
+	width             int
+	height            int // zero until the first tea.WindowSizeMsg
+	planUpdates       chan tea.Msg  // progress and result of plan generation
+	planProgress      *PlanProgress // nil until a chunked plan reports progress
 	executionSteps    []ExecutionStep
+	run               *migrationRun
+	ctx               context.Context // cancelled on quit to abort in-flight AI calls
+	cancel            context.CancelFunc
 	currentStep       int
-	showingSteps      bool
+	failedStage       failureStage // what failed, while recovering
+	selectedRecovery  int
+	skipping          bool     // a justification for skipping the current step is being entered
+	rolledBack        []string // what aborting the run or rolling back the migration undid
+	checkpointFile    string   // state file the run is saved to after every step
+	checkpointErr     error    // why the last checkpoint could not be saved
+	resumedFrom       string   // when the resumed checkpoint was saved
+	rollingBack       bool     // the completed migration is being rolled back
+	migrationUndone   bool
+	rollbackErr       error
 	userApproved      bool
 }
 
@@ -214,70 +284,67 @@ var (
 		Margin(1)
 )
 
-func NewEngineRoomEnhancedMigrator(apiKey string) *EngineRoomEnhancedMigrator {
-	return &EngineRoomEnhancedMigrator{
-		apiKey: apiKey,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-	}
-}
-
-func (c *EngineRoomEnhancedMigrator) callEngineRoom(prompt string) (string, error) {
-	request := EngineRoomRequest{
-		Model:     "claude-3-sonnet-20240229",
-		MaxTokens: 4000,
-		Messages: []EngineRoomMessage{
-			{
-				Role: "user",
-				Content: prompt,
-			},
-		},
-	}
-
-	jsonData, err := json.Marshal(request)
+func NewEngineRoomEnhancedMigrator(config LLMConfig) (*EngineRoomEnhancedMigrator, error) {
+	provider, err := newLLMProvider(config)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	redaction, err := parseRedactionPolicy(config.Redaction)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	metered := &meteredProvider{inner: provider, model: config.model(), budget: config.Budget}
+	chunkSize := config.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultPlanChunkSize
 	}
+	return &EngineRoomEnhancedMigrator{
+		provider:  metered,
+		usage:     metered,
+		redaction: redaction,
+		chunkSize: chunkSize,
+	}, nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", c.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+// Usage returns the tokens and estimated cost of every call made so far.
+func (c *EngineRoomEnhancedMigrator) Usage() *UsageSummary {
+	return c.usage.Usage()
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+func (c *EngineRoomEnhancedMigrator) callEngineRoom(ctx context.Context, prompt string) (string, error) {
+	return c.converse(ctx, []EngineRoomMessage{
+		{
+			Role:    "user",
+			Content: prompt,
+		},
+	})
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+// converse sends a whole conversation and returns the model's reply.
+func (c *EngineRoomEnhancedMigrator) converse(ctx context.Context, messages []EngineRoomMessage) (string, error) {
+	response, err := c.provider.Complete(ctx, messages)
 	if err != nil {
 		return "", err
 	}
+	return response.Text, nil
+}
 
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("Engine Room AI API error: %s", string(body))
+// PlanMigrationOrder asks Engine Room AI for the order to migrate users and
+// port numbers to targetFormat, with a to-do list and risk assessment.
+func (c *EngineRoomEnhancedMigrator) PlanMigrationOrder(ctx context.Context, system *CanonicalPhoneSystem, targetFormat string) (*MigrationPlan, error) {
+	if len(system.Users) > c.chunkSize || len(system.Numbers) > c.chunkSize {
+		return c.planInChunks(ctx, system, targetFormat)
 	}
 
-	var engineRoomResp EngineRoomResponse
-	if err := json.Unmarshal(body, &engineRoomResp); err != nil {
-		return "", err
+	redactor, err := newRedactor(c.redaction)
+	if err != nil {
+		return nil, err
 	}
-
-	if len(engineRoomResp.Content) == 0 {
-		return "", fmt.Errorf("no content in Engine Room AI response")
+	usersJSON, err := json.MarshalIndent(redactor.RedactUsers(system.Users), "", "  ")
+	if err != nil {
+		return nil, err
 	}
-
-	return engineRoomResp.Content[0].Text, nil
-}
-
-func (c *EngineRoomEnhancedMigrator) PlanMigrationOrder(users []TwilioUser) (*MigrationPlan, error) {
-	usersJSON, err := json.MarshalIndent(users, "", "  ")
+	numbersJSON, err := json.MarshalIndent(redactor.RedactNumbers(system.Numbers), "", "  ")
 	if err != nil {
 		return nil, err
 	}
@@ -287,19 +354,25 @@ func (c *EngineRoomEnhancedMigrator) PlanMigrationOrder(users []TwilioUser) (*Mi
 User Accounts to Migrate:
 %s
 
+Phone Numbers to Port:
+%s
+
+%s
+
 Please provide a detailed migration plan with:
 1. Analysis of the accounts and optimal order
-2. A step-by-step to-do list for the migration process
-3. Risk assessment and mitigation strategies
-4. Estimated time for completion
+2. Which phone numbers to port first, and the risk of porting each one
+3. A step-by-step to-do list for the migration process
+4. Risk assessment and mitigation strategies
+5. Estimated time for completion
 
 Respond with a JSON object in this exact format:
 {
   "recommended_order": [
     {
       "account": {
-        "account_sid": "AC123",
-        "friendly_name": "John Doe",
+        "id": "AC123",
+        "name": "John Doe",
         "email": "john@example.com",
         "phone_number": "+1234567890",
         "status": "active"
@@ -309,58 +382,74 @@ Respond with a JSON object in this exact format:
       "risk_level": "low"
     }
   ],
+  "number_plan": [
+    {
+      "number": {
+        "id": "PN123",
+        "phone_number": "+1234567890",
+        "capabilities": {"voice": true, "sms": true, "fax": true},
+        "location": "New York, NY"
+      },
+      "priority": 1,
+      "reason": "Main office line - port early in a quiet period so problems are found quickly",
+      "risk_level": "medium",
+      "capabilities_at_risk": ["fax"]
+    }
+  ],
   "reasoning": "Overall strategy explanation focusing on minimizing business disruption",
   "risk_assessment": "Detailed risk analysis and mitigation strategies",
   "todo_list": [
     {
       "step": 1,
       "description": "Backup current system data",
-      "action": "Create full backup of Twilio configuration and user data",
-      "risk": "low"
+      "action": "Create full backup of the source system configuration and user data",
+      "risk": "low",
+      "executor": "backup"
     },
     {
       "step": 2,
       "description": "Validate data integrity",
       "action": "Check for missing fields, invalid phone numbers, duplicate accounts",
-      "risk": "medium"
+      "risk": "medium",
+      "executor": "validate"
     },
     {
       "step": 3,
       "description": "Begin user migration in priority order",
       "action": "Migrate users according to recommended order with validation",
-      "risk": "high"
+      "risk": "high",
+      "executor": "convert_users"
     }
   ],
   "estimated_time": "15-20 minutes including validation steps"
 }
 
-Create a comprehensive to-do list with 5-8 steps that covers the entire migration process from preparation to completion.`, string(usersJSON))
-
-	response, err := c.callEngineRoom(prompt)
-	if err != nil {
-		return nil, fmt.Errorf("Engine Room AI API error: %w", err)
-	}
+Include every phone number in "number_plan", copied exactly as given.
+Create a comprehensive to-do list with 5-8 steps that covers the entire migration process from preparation to completion.
+Set "executor" on each step to the automated operation that performs it: backup, validate, order, convert_users, convert_numbers, roundtrip, verify or write.
+Use "manual" for steps that need a person to act, such as notifying users.`, string(usersJSON), string(numbersJSON), targetCapabilitiesNote(targetFormat))
 
-	// Extract JSON from Engine Room AI's response
-	jsonStart := strings.Index(response, "{")
-	jsonEnd := strings.LastIndex(response, "}") + 1
-	
-	if jsonStart == -1 || jsonEnd == 0 {
-		return nil, fmt.Errorf("no valid JSON found in Engine Room AI response")
+	validate := validateMigrationPlan
+	if len(system.Numbers) > 0 {
+		validate = requireNumberPlan(validateMigrationPlan)
 	}
-
-	jsonStr := response[jsonStart:jsonEnd]
-	
-	var plan MigrationPlan
-	if err := json.Unmarshal([]byte(jsonStr), &plan); err != nil {
-		return nil, fmt.Errorf("failed to parse Engine Room AI response: %w\nResponse: %s", err, jsonStr)
+	plan, err := c.requestPlan(ctx, prompt, validate)
+	if err != nil {
+		return nil, err
 	}
-
-	return &plan, nil
+	redactor.RestorePlan(plan)
+	plan.GeneratedBy = planGeneratorEngineRoom
+	plan.RedactionKeyID = redactor.KeyID()
+	plan.Usage = c.Usage()
+	return plan, nil
 }
 
-func (c *EngineRoomEnhancedMigrator) AnalyzeDataQuality(users []TwilioUser) (string, error) {
-	usersJSON, _ := json.MarshalIndent(users, "", "  ")
+func (c *EngineRoomEnhancedMigrator) AnalyzeDataQuality(ctx context.Context, system *CanonicalPhoneSystem) (string, error) {
+	redactor, err := newRedactor(c.redaction)
+	if err != nil {
+		return "", err
+	}
+	usersJSON, _ := json.MarshalIndent(redactor.RedactUsers(system.Users), "", "  ")
 	
 	prompt := fmt.Sprintf(`Analyze this phone system data for migration readiness:
 
@@ -375,7 +464,11 @@ Please check for:
 
 Provide a concise analysis with specific recommendations for data cleanup before migration.`, string(usersJSON))
 
-	return c.callEngineRoom(prompt)
+	analysis, err := c.callEngineRoom(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return redactor.RestoreText(analysis), nil
 }
 
 func initialModel() model {
@@ -387,45 +480,55 @@ func initialModel() model {
 	ti.Placeholder = "Enter source JSON filename..."
 	ti.Focus()
 
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return model{
-		state:         enteringSource,
-		spinner:       s,
-		textInput:     ti,
-		sourceFormats: []string{"Twilio", "RingCentral"},
-		targetFormats: []string{"Twilio", "RingCentral"},
-		aiOptions:     []string{"Yes - Use Engine Room AI", "No - Standard migration"},
+		ctx:            ctx,
+		cancel:         cancel,
+		config:         MigrationConfig{LLM: llmConfigFromEnv()},
+		state:          enteringSource,
+		spinner:        s,
+		textInput:      ti,
+		filepicker:     newSourcePicker(),
+		checkpointFile: defaultCheckpointFile,
+		viewport:       newViewport(),
+		sourceFormats:  AdapterNames(),
+		targetFormats:  AdapterNames(),
+		aiOptions:      []string{"Yes - Use Engine Room AI", "Offline - Rule-based migration plan", "No - Standard migration"},
 	}
 }
 
 func (m model) Init() tea.Cmd {
-	return m.spinner.Tick
+	if m.state == executingPlan {
+		// Resuming from a checkpoint
+		return tea.Batch(m.spinner.Tick, func() tea.Msg { return resumeMsg{} })
+	}
+	return tea.Batch(m.spinner.Tick, m.filepicker.Init())
+}
+
+// quit cancels any in-flight Engine Room AI call before exiting.
+func (m model) quit() (tea.Model, tea.Cmd) {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	return m, tea.Quit
 }
 
-func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+// update handles every message for the current screen. Update wraps it.
+func (m model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch m.state {
 		case enteringSource:
-			switch msg.String() {
-			case "ctrl+c", "q":
-				return m, tea.Quit
-			case "enter":
-				if m.textInput.Value() != "" {
-					m.config.SourceFile = m.textInput.Value()
-					if !strings.HasSuffix(m.config.SourceFile, ".json") {
-						m.config.SourceFile += ".json"
-					}
-					m.state = selectingSourceFormat
-				}
-			}
-			var cmd tea.Cmd
-			m.textInput, cmd = m.textInput.Update(msg)
-			return m, cmd
+			return m.updateSourcePicker(msg)
+
+		case previewingSource:
+			return m.updateSourcePreview(msg)
 
 		case selectingSourceFormat:
 			switch msg.String() {
 			case "ctrl+c", "q":
-				return m, tea.Quit
+				return m.quit()
 			case "up", "k":
 				if m.selectedSource > 0 {
 					m.selectedSource--
@@ -434,18 +537,20 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if m.selectedSource < len(m.sourceFormats)-1 {
 					m.selectedSource++
 				}
+			case "esc":
+				m.state = previewingSource
 			case "enter", " ":
 				m.config.SourceFormat = m.sourceFormats[m.selectedSource]
-				m.state = enteringTarget
-				m.textInput.SetValue("")
-				m.textInput.Placeholder = "Enter target filename..."
-				m.textInput.Focus()
+				m = m.enterTarget()
 			}
 
 		case enteringTarget:
 			switch msg.String() {
 			case "ctrl+c", "q":
-				return m, tea.Quit
+				return m.quit()
+			case "esc":
+				m.state = selectingSourceFormat
+				return m, nil
 			case "enter":
 				if m.textInput.Value() != "" {
 					m.config.TargetFile = m.textInput.Value()
@@ -462,7 +567,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case selectingTargetFormat:
 			switch msg.String() {
 			case "ctrl+c", "q":
-				return m, tea.Quit
+				return m.quit()
 			case "up", "k":
 				if m.selectedTarget > 0 {
 					m.selectedTarget--
@@ -471,6 +576,8 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if m.selectedTarget < len(m.targetFormats)-1 {
 					m.selectedTarget++
 				}
+			case "esc":
+				m = m.enterTarget()
 			case "enter", " ":
 				m.config.TargetFormat = m.targetFormats[m.selectedTarget]
 				m.state = askingAIPreference
@@ -479,7 +586,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case askingAIPreference:
 			switch msg.String() {
 			case "ctrl+c", "q":
-				return m, tea.Quit
+				return m.quit()
 			case "up", "k":
 				if m.selectedAI > 0 {
 					m.selectedAI--
@@ -488,20 +595,15 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if m.selectedAI < len(m.aiOptions)-1 {
 					m.selectedAI++
 				}
+			case "esc":
+				m.state = selectingTargetFormat
 			case "enter", " ":
 				m.config.UseAI = m.selectedAI == 0 // First option is "Yes"
-				if m.config.UseAI {
-					m.state = showingPlan
-					return m, tea.Batch(
-						m.spinner.Tick,
-						generateMigrationPlan(m.config),
-					)
+				m.config.OfflinePlan = m.selectedAI == 1
+				if m.config.UseAI || m.config.OfflinePlan {
+					return m.startPlanning()
 				} else {
-					m.state = executingPlan
-					return m, tea.Batch(
-						m.spinner.Tick,
-						performMigration(m.config),
-					)
+					return m.startStandardMigration()
 				}
 			}
 
@@ -509,38 +611,72 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Just waiting for plan generation
 			switch msg.String() {
 			case "ctrl+c", "q":
-				return m, tea.Quit
+				return m.quit()
 			}
 
 		case confirmingPlan:
+			if m.chatting {
+				return m.updatePlanChat(msg)
+			}
 			switch msg.String() {
 			case "ctrl+c", "q":
-				return m, tea.Quit
+				return m.quit()
+			case "c", "C":
+				if m.canRefinePlan() {
+					return m.startPlanChat(), nil
+				}
 			case "y", "Y", "enter":
 				m.userApproved = true
 				m.state = executingPlan
 				m.currentStep = 0
+				m.run = newMigrationRun(m.config, m.migrationPlan)
 				m = m.initializeExecutionSteps()
-				return m, tea.Batch(
-					m.spinner.Tick,
-					executeNextStep(m.config, m.migrationPlan, 0),
-				)
+				var cmd tea.Cmd
+				m, cmd = m.startCurrentStep()
+				return m, tea.Batch(m.spinner.Tick, cmd)
+			case "e", "E":
+				return m.startEditingPlan(), nil
+			case "h", "H":
+				m.config.ApproveHighRisk = !m.config.ApproveHighRisk
 			case "n", "N":
 				m.state = completed
 				m.err = fmt.Errorf("migration cancelled by user")
 			}
 
+		case editingPlan:
+			return m.updatePlanEditor(msg)
+
 		case executingPlan:
+			if model, cmd, handled := m.updateStepControl(msg); handled {
+				return model, cmd
+			}
 			switch msg.String() {
 			case "ctrl+c", "q":
-				return m, tea.Quit
+				return m.quit()
+			case "enter", "a":
+				// Acknowledge a manual step and move on
+				if m.currentStep < len(m.executionSteps) && m.executionSteps[m.currentStep].Status == "awaiting" {
+					m.executionSteps[m.currentStep].Status = "acknowledged"
+					m.executionSteps[m.currentStep].Details = "✓ Acknowledged manual step: " + m.executionSteps[m.currentStep].Action
+					m.currentStep++
+					return m.startCurrentStep()
+				}
 			}
 
 		case completed:
 			switch msg.String() {
 			case "ctrl+c", "q", "enter", " ":
-				return m, tea.Quit
+				return m.quit()
+			case "u", "U":
+				if m.migrationDone && !m.rollingBack && !m.migrationUndone {
+					m.rollingBack = true
+					m.rollbackErr = nil
+					return m, rollbackMigration(m.config.TargetFile)
+				}
 			}
+
+		case recovering:
+			return m.updateRecovery(msg)
 		}
 
 	case spinner.TickMsg:
@@ -548,24 +684,39 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.spinner, cmd = m.spinner.Update(msg)
 		return m, cmd
 
+	case planProgressMsg:
+		progress := PlanProgress(msg)
+		m.planProgress = &progress
+		return m, waitForPlanUpdate(m.planUpdates)
+
 	case migrationPlanMsg:
 		m.migrationPlan = msg.plan
 		if msg.err != nil {
-			m.err = msg.err
-			m.state = completed
+			return m.fail(planFailed, msg.err), nil
 		} else {
 			m.state = confirmingPlan
 		}
 
+	case planRevisedMsg:
+		return m.applyPlanRevision(msg), nil
+
+	case resumeMsg:
+		return m.resumeRun()
+
+	case rollbackDoneMsg:
+		m.rollingBack = false
+		m.rolledBack = msg.done
+		m.rollbackErr = msg.err
+		m.migrationUndone = msg.err == nil
+
 	case stepCompleteMsg:
 		if msg.err != nil {
-			// Step failed
+			// Step failed, wait for the user to retry, skip or abort
 			if m.currentStep < len(m.executionSteps) {
 				m.executionSteps[m.currentStep].Status = "failed"
 				m.executionSteps[m.currentStep].Error = msg.err
 			}
-			m.err = msg.err
-			m.state = completed
+			m = m.saveCheckpoint()
 		} else {
 			// Step completed successfully
 			if m.currentStep < len(m.executionSteps) {
@@ -573,25 +724,22 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.executionSteps[m.currentStep].Details = msg.details
 			}
 			m.currentStep++
-			
-			if m.currentStep >= len(m.executionSteps) {
-				// All steps completed
-				m.state = completed
-				m.migrationDone = true
-			} else {
-				// Mark next step as running and execute it
-				if m.currentStep < len(m.executionSteps) {
-					m.executionSteps[m.currentStep].Status = "running"
-				}
-				return m, executeNextStep(m.config, m.migrationPlan, m.currentStep)
-			}
+			return m.startCurrentStep()
 		}
 
 	case migrationCompleteMsg:
+		if msg.err != nil {
+			return m.fail(migrationFailed, msg.err), nil
+		}
 		m.state = completed
 		m.migrationDone = true
-		if msg.err != nil {
-			m.err = msg.err
+
+	default:
+		// The file picker reads directories in the background
+		if m.state == enteringSource {
+			var cmd tea.Cmd
+			m.filepicker, cmd = m.filepicker.Update(msg)
+			return m, cmd
 		}
 	}
 
@@ -606,12 +754,10 @@ func (m model) View() string {
 
 	switch m.state {
 	case enteringSource:
-		s.WriteString(subtitleStyle.Render("Step 1: Enter source JSON filename"))
-		s.WriteString("\n\n")
-		s.WriteString("Source filename:\n")
-		s.WriteString(m.textInput.View())
-		s.WriteString("\n\n")
-		s.WriteString(helpStyle.Render("Type filename and press Enter, quit with q"))
+		s.WriteString(m.sourcePickerView())
+
+	case previewingSource:
+		s.WriteString(m.sourcePreviewView())
 
 	case selectingSourceFormat:
 		s.WriteString(subtitleStyle.Render("Step 2: Select source format"))
@@ -622,10 +768,14 @@ func (m model) View() string {
 			if i == m.selectedSource {
 				cursor = ">"
 			}
-			s.WriteString(fmt.Sprintf("%s %s\n", cursor, format))
+			detected := ""
+			if format == m.detectedFormat {
+				detected = " (detected)"
+			}
+			s.WriteString(fmt.Sprintf("%s %s%s\n", cursor, format, detected))
 		}
 		s.WriteString("\n")
-		s.WriteString(helpStyle.Render("Navigate with ↑/↓, select with Enter"))
+		s.WriteString(helpStyle.Render("Navigate with ↑/↓, select with Enter, Esc to go back"))
 
 	case enteringTarget:
 		s.WriteString(subtitleStyle.Render("Step 3: Enter target filename"))
@@ -634,7 +784,7 @@ func (m model) View() string {
 		s.WriteString("Target filename:\n")
 		s.WriteString(m.textInput.View())
 		s.WriteString("\n\n")
-		s.WriteString(helpStyle.Render("Type filename and press Enter"))
+		s.WriteString(helpStyle.Render("Type filename and press Enter, Esc to go back"))
 
 	case selectingTargetFormat:
 		s.WriteString(subtitleStyle.Render("Step 4: Select target format"))
@@ -649,12 +799,13 @@ func (m model) View() string {
 			s.WriteString(fmt.Sprintf("%s %s\n", cursor, format))
 		}
 		s.WriteString("\n")
-		s.WriteString(helpStyle.Render("Navigate with ↑/↓, select with Enter"))
+		s.WriteString(helpStyle.Render("Navigate with ↑/↓, select with Enter, Esc to go back"))
 
 	case askingAIPreference:
 		s.WriteString(aiStyle.Render("Step 5: Use Engine Room AI for smart migration?"))
 		s.WriteString("\n\n")
-		s.WriteString("Engine Room AI can analyze your data and create a detailed migration plan.\n\n")
+		s.WriteString("Engine Room AI can analyze your data and create a detailed migration plan.\n")
+		s.WriteString("The offline planner builds a rule-based plan without network access.\n\n")
 		for i, option := range m.aiOptions {
 			cursor := " "
 			if i == m.selectedAI {
@@ -663,120 +814,246 @@ func (m model) View() string {
 			s.WriteString(fmt.Sprintf("%s %s\n", cursor, option))
 		}
 		s.WriteString("\n")
-		s.WriteString(helpStyle.Render("Navigate with ↑/↓, select with Enter"))
+		s.WriteString(helpStyle.Render("Navigate with ↑/↓, select with Enter, Esc to go back"))
 
 	case showingPlan:
-		s.WriteString(aiStyle.Render("🤖 Engine Room AI is analyzing your data and creating a migration plan..."))
-		s.WriteString("\n\n")
-		s.WriteString(m.spinner.View() + " Please wait while Engine Room AI examines your phone system data...\n\n")
-
-	case confirmingPlan:
-		if m.migrationPlan != nil {
-			s.WriteString(aiStyle.Render("📋 Engine Room AI's Migration Plan"))
+		if m.config.UseAI {
+			s.WriteString(aiStyle.Render("🤖 Engine Room AI is analyzing your data and creating a migration plan..."))
 			s.WriteString("\n\n")
-			
-			// Show estimated time
-			s.WriteString(fmt.Sprintf("⏱️  Estimated Time: %s\n\n", m.migrationPlan.EstimatedTime))
-			
-			// Show strategy
-			s.WriteString(subtitleStyle.Render("📊 Migration Strategy:"))
-			s.WriteString("\n")
-			s.WriteString(m.migrationPlan.Reasoning)
-			s.WriteString("\n\n")
-			
-			// Show risk assessment
-			s.WriteString(subtitleStyle.Render("⚠️  Risk Assessment:"))
-			s.WriteString("\n")
-			s.WriteString(m.migrationPlan.RiskAssessment)
-			s.WriteString("\n\n")
-			
-			// Show to-do list
-			todoContent := aiStyle.Render("✅ Migration To-Do List:") + "\n\n"
-			for _, todo := range m.migrationPlan.TodoList {
-				riskIcon := "🟢"
-				if todo.Risk == "medium" {
-					riskIcon = "🟡"
-				} else if todo.Risk == "high" {
-					riskIcon = "🔴"
-				}
-				todoContent += fmt.Sprintf("%d. %s %s\n", todo.Step, riskIcon, todo.Description)
-				todoContent += fmt.Sprintf("   Action: %s\n\n", todo.Action)
-			}
-			s.WriteString(todoStyle.Render(todoContent))
-			
-			// Show user order
-			s.WriteString(subtitleStyle.Render("👥 User Migration Order:"))
-			s.WriteString("\n")
-			for i, item := range m.migrationPlan.RecommendedOrder {
-				s.WriteString(fmt.Sprintf("%d. %s (%s) - %s\n", 
-					i+1, item.Account.Name, item.Account.Email, item.Reason))
+			if p := m.planProgress; p != nil {
+				s.WriteString(fmt.Sprintf("%s %s\n", m.spinner.View(), p.Stage))
+				s.WriteString(fmt.Sprintf("Chunks planned: %d/%d %s\n\n", p.Chunk, p.Chunks, progressBar(p.Chunk, p.Chunks, 30)))
+			} else {
+				s.WriteString(m.spinner.View() + " Please wait while Engine Room AI examines your phone system data...\n\n")
 			}
-			s.WriteString("\n")
-			
-			s.WriteString(successStyle.Render("Do you want to proceed with this plan? (Y/n)"))
+		} else {
+			s.WriteString(aiStyle.Render("📐 Building a rule-based migration plan..."))
+			s.WriteString("\n\n")
+			s.WriteString(m.spinner.View() + " Please wait while the offline planner examines your phone system data...\n\n")
 		}
 
-	case executingPlan:
-		s.WriteString(aiStyle.Render("🚀 Executing Migration Plan"))
+	case confirmingPlan, executingPlan, completed:
+		s.WriteString(m.scrollableView())
+
+	case editingPlan:
+		s.WriteString(m.planEditorView())
+
+	case recovering:
+		s.WriteString(m.recoveryView())
+	}
+
+	return s.String()
+}
+
+// planView is the plan being confirmed, with what was edited or revised.
+func (m model) planView() string {
+	var s strings.Builder
+	if m.migrationPlan == nil {
+		return ""
+	}
+
+	s.WriteString(aiStyle.Render(fmt.Sprintf("📋 %s's Migration Plan", m.migrationPlan.GeneratedBy)))
+	s.WriteString("\n\n")
+	
+	// Show estimated time
+	s.WriteString(fmt.Sprintf("⏱️  Estimated Time: %s\n\n", m.migrationPlan.EstimatedTime))
+	if m.migrationPlan.Repairs > 0 {
+		s.WriteString(helpStyle.Render(fmt.Sprintf("The plan was corrected after %d invalid response(s) from Engine Room AI", m.migrationPlan.Repairs)))
 		s.WriteString("\n\n")
-		
-		// Show progress through steps
-		for _, step := range m.executionSteps {
-			var statusIcon, statusText string
-			var style lipgloss.Style
-			
-			switch step.Status {
-			case "pending":
-				statusIcon = "⏳"
-				statusText = "Pending"
-				style = stepPendingStyle
-			case "running":
-				statusIcon = m.spinner.View()
-				statusText = "Running"
-				style = stepRunningStyle
-			case "completed":
-				statusIcon = "✅"
-				statusText = "Completed"
-				style = stepCompletedStyle
-			case "failed":
-				statusIcon = "❌"
-				statusText = "Failed"
-				style = stepFailedStyle
-			}
-			
-			s.WriteString(style.Render(fmt.Sprintf("%s Step %d: %s [%s]", 
-				statusIcon, step.StepNumber, step.Description, statusText)))
-			s.WriteString("\n")
-			
-			if step.Details != "" {
-				s.WriteString(fmt.Sprintf("   %s\n", step.Details))
-			}
-			if step.Error != nil {
-				s.WriteString(stepFailedStyle.Render(fmt.Sprintf("   Error: %v\n", step.Error)))
-			}
+	}
+	
+	// Show strategy
+	s.WriteString(subtitleStyle.Render("📊 Migration Strategy:"))
+	s.WriteString("\n")
+	s.WriteString(m.migrationPlan.Reasoning)
+	s.WriteString("\n\n")
+	
+	// Show risk assessment
+	s.WriteString(subtitleStyle.Render("⚠️  Risk Assessment:"))
+	s.WriteString("\n")
+	s.WriteString(m.migrationPlan.RiskAssessment)
+	s.WriteString("\n\n")
+
+	// Show reconciliation findings
+	if len(m.migrationPlan.Reconciliation) > 0 {
+		s.WriteString(errorStyle.Render("🔍 Plan Reconciliation:"))
+		s.WriteString("\n")
+		for _, discrepancy := range m.migrationPlan.Reconciliation {
+			s.WriteString(fmt.Sprintf("• %s %s: %s\n", discrepancy.Kind, discrepancy.Subject(), discrepancy.Detail))
 		}
 		s.WriteString("\n")
-
-	case completed:
-		if m.err != nil {
-			s.WriteString(errorStyle.Render("❌ Migration failed"))
-			s.WriteString("\n\n")
-			s.WriteString(fmt.Sprintf("Error: %v\n", m.err))
+	}
+	
+	// Show to-do list, marking what the latest revision changed
+	changed := changedSubjects(m.lastChanges)
+	todoContent := aiStyle.Render("✅ Migration To-Do List:") + "\n\n"
+	for _, todo := range m.migrationPlan.TodoList {
+		riskIcon := "🟢"
+		if todo.Risk == "medium" {
+			riskIcon = "🟡"
+		} else if todo.Risk == "high" {
+			riskIcon = "🔴"
+		}
+		if changed[todo.Description] {
+			todoContent += aiStyle.Render(fmt.Sprintf("%d. %s %s ●", todo.Step, riskIcon, todo.Description)) + "\n"
 		} else {
-			s.WriteString(successStyle.Render("✅ Migration completed successfully!"))
-			s.WriteString("\n\n")
-			if m.config.UseAI {
-				s.WriteString(aiStyle.Render("🧠 Enhanced with Engine Room AI analysis"))
+			todoContent += fmt.Sprintf("%d. %s %s\n", todo.Step, riskIcon, todo.Description)
+		}
+		todoContent += fmt.Sprintf("   Action: %s\n\n", todo.Action)
+	}
+	s.WriteString(todoStyle.Render(todoContent))
+	
+	// Show user order
+	s.WriteString(subtitleStyle.Render("👥 User Migration Order:"))
+	s.WriteString("\n")
+	for i, item := range m.migrationPlan.RecommendedOrder {
+		line := fmt.Sprintf("%d. %s (%s) - %s", i+1, item.Account.Name, item.Account.Email, item.Reason)
+		if changed[item.Account.ID] {
+			line = aiStyle.Render(line + " ●")
+		}
+		s.WriteString(line + "\n")
+	}
+	for _, item := range m.migrationPlan.Excluded {
+		s.WriteString(stepPendingStyle.Render(fmt.Sprintf("-. %s (%s) - excluded", item.Account.Name, item.Account.Email)))
+		s.WriteString("\n")
+	}
+	s.WriteString("\n")
+
+	// Show number porting order
+	if len(m.migrationPlan.NumberPlan) > 0 {
+		s.WriteString(subtitleStyle.Render("📞 Number Porting Order:"))
+		s.WriteString("\n")
+		for i, item := range m.migrationPlan.NumberPlan {
+			s.WriteString(fmt.Sprintf("%d. %s %s [%s risk] - %s\n",
+				i+1, riskEmoji(item.Risk), item.Number.Number, item.Risk, item.Reason))
+			if len(item.CapabilitiesAtRisk) > 0 {
+				s.WriteString(errorStyle.Render(fmt.Sprintf("   ⚠ Lost in %s: %s", m.config.TargetFormat, strings.Join(item.CapabilitiesAtRisk, ", "))))
 				s.WriteString("\n")
 			}
-			s.WriteString(fmt.Sprintf("Data migrated from %s (%s) to %s (%s)\n",
-				m.config.SourceFile, m.config.SourceFormat,
-				m.config.TargetFile, m.config.TargetFormat))
 		}
 		s.WriteString("\n")
-		s.WriteString(helpStyle.Render("Press any key to exit"))
 	}
+	
+	if len(m.migrationPlan.Edits) > 0 {
+		s.WriteString(subtitleStyle.Render(fmt.Sprintf("✏️  Your Edits (%d):", len(m.migrationPlan.Edits))))
+		s.WriteString("\n")
+		for _, edit := range m.migrationPlan.Edits {
+			s.WriteString(fmt.Sprintf("• %s: %s\n", edit.Subject, edit.Detail))
+		}
+		s.WriteString("\n")
+	}
+
+	if len(m.lastChanges) > 0 {
+		s.WriteString(aiStyle.Render(fmt.Sprintf("🔄 Changed by the last revision (%d, marked ●):", len(m.lastChanges))))
+		s.WriteString("\n")
+		for _, change := range m.lastChanges {
+			s.WriteString(fmt.Sprintf("• %s: %s\n", change.Subject, change.Detail))
+		}
+		s.WriteString("\n")
+	}
+	return s.String()
+}
+
+// stepsView lists the execution steps with their status and results.
+func (m model) stepsView() string {
+	var s strings.Builder
+
+	// Show progress through steps
+	for _, step := range m.executionSteps {
+		var statusIcon, statusText string
+		var style lipgloss.Style
+		
+		switch step.Status {
+		case "pending":
+			statusIcon = "⏳"
+			statusText = "Pending"
+			style = stepPendingStyle
+		case "running":
+			statusIcon = m.spinner.View()
+			statusText = "Running"
+			style = stepRunningStyle
+		case "completed":
+			statusIcon = "✅"
+			statusText = "Completed"
+			style = stepCompletedStyle
+		case "awaiting":
+			statusIcon = "✋"
+			statusText = "Manual - press Enter to acknowledge"
+			style = stepRunningStyle
+		case "acknowledged":
+			statusIcon = "☑️"
+			statusText = "Acknowledged"
+			style = stepCompletedStyle
+		case "approval":
+			statusIcon = "🔐"
+			statusText = "High risk - waiting for approval"
+			style = stepRunningStyle
+		case "failed":
+			statusIcon = "❌"
+			statusText = "Failed"
+			style = stepFailedStyle
+		case "skipped":
+			statusIcon = "⏭️"
+			statusText = "Skipped"
+			style = stepPendingStyle
+		}
+		
+		s.WriteString(style.Render(fmt.Sprintf("%s Step %d: %s [%s]", 
+			statusIcon, step.StepNumber, step.Description, statusText)))
+		s.WriteString("\n")
+		
+		if step.Details != "" {
+			s.WriteString(fmt.Sprintf("   %s\n", step.Details))
+		}
+		if step.Error != nil {
+			s.WriteString(stepFailedStyle.Render(fmt.Sprintf("   Error: %v", step.Error)) + "\n")
+		}
+		if step.Justification != "" {
+			s.WriteString(fmt.Sprintf("   Skipped because: %s\n", step.Justification))
+		}
+	}
+	return s.String()
+}
+
+// reportView is the outcome of the migration, followed by the result of
+// every step when the plan was executed step by step.
+func (m model) reportView() string {
+	var s strings.Builder
 
+	if m.err != nil {
+		s.WriteString(errorStyle.Render("❌ Migration failed"))
+		s.WriteString("\n\n")
+		s.WriteString(fmt.Sprintf("Error: %v\n", m.err))
+	} else {
+		s.WriteString(successStyle.Render("✅ Migration completed successfully!"))
+		s.WriteString("\n\n")
+		if m.migrationPlan != nil && m.migrationPlan.GeneratedBy == planGeneratorOffline {
+			s.WriteString(aiStyle.Render("📐 Planned by the offline rule-based planner"))
+			s.WriteString("\n")
+		} else if m.config.UseAI {
+			s.WriteString(aiStyle.Render("🧠 Enhanced with Engine Room AI analysis"))
+			s.WriteString("\n")
+			if m.migrationPlan != nil && m.migrationPlan.Usage != nil {
+				s.WriteString(fmt.Sprintf("💰 Engine Room AI usage: %s\n", m.migrationPlan.Usage))
+			}
+		}
+		s.WriteString(fmt.Sprintf("Data migrated from %s (%s) to %s (%s)\n",
+			m.config.SourceFile, m.config.SourceFormat,
+			m.config.TargetFile, m.config.TargetFormat))
+		if m.run != nil && len(m.run.skipped) > 0 {
+			s.WriteString(errorStyle.Render(fmt.Sprintf("⚠ %d step(s) skipped, see the report below", len(m.run.skipped))))
+			s.WriteString("\n")
+		}
+	}
+
+	s.WriteString(m.rollbackView())
+
+	if len(m.executionSteps) > 0 {
+		s.WriteString("\n")
+		s.WriteString(subtitleStyle.Render("📋 Execution Report:"))
+		s.WriteString("\n")
+		s.WriteString(m.stepsView())
+	}
 	return s.String()
 }
 
@@ -785,166 +1062,228 @@ type migrationCompleteMsg struct {
 	err error
 }
 
+// riskEmoji marks a low, medium or high risk level.
+func riskEmoji(risk string) string {
+	switch risk {
+	case "high":
+		return "🔴"
+	case "medium":
+		return "🟡"
+	}
+	return "🟢"
+}
+
 type migrationPlanMsg struct {
 	plan *MigrationPlan
 	err  error
 }
 
+type planProgressMsg PlanProgress
+
 type stepCompleteMsg struct {
 	stepNumber int
 	details    string
 	err        error
 }
 
-func generateMigrationPlan(config MigrationConfig) tea.Cmd {
+// generateMigrationPlan builds the plan in the background and sends progress
+// and then the result to updates.
+func generateMigrationPlan(ctx context.Context, config MigrationConfig, updates chan<- tea.Msg) tea.Cmd {
 	return func() tea.Msg {
-		apiKey := os.Getenv("ANTHROPIC_API_KEY")
-		if apiKey == "" {
-			return migrationPlanMsg{nil, fmt.Errorf("ANTHROPIC_API_KEY environment variable not set")}
-		}
-
-		// Read source file
-		sourceData, err := ioutil.ReadFile(config.SourceFile)
-		if err != nil {
-			return migrationPlanMsg{nil, fmt.Errorf("failed to read source file: %w", err)}
-		}
-
-		// Parse source data
-		var twilioSystem TwilioPhoneSystem
-		if err := json.Unmarshal(sourceData, &twilioSystem); err != nil {
-			return migrationPlanMsg{nil, fmt.Errorf("failed to parse source data: %w", err)}
-		}
-
-		// Get Engine Room AI's migration plan
-		engineRoomMigrator := NewEngineRoomEnhancedMigrator(apiKey)
-		plan, err := engineRoomMigrator.PlanMigrationOrder(twilioSystem.Users)
-		if err != nil {
-			return migrationPlanMsg{nil, fmt.Errorf("Engine Room AI analysis failed: %w", err)}
+		send := func(msg tea.Msg) {
+			select {
+			case updates <- msg:
+			case <-ctx.Done():
+			}
 		}
-
-		return migrationPlanMsg{plan, nil}
+		plan, err := buildMigrationPlan(ctx, config, func(progress PlanProgress) {
+			send(planProgressMsg(progress))
+		})
+		send(migrationPlanMsg{plan, err})
+		return nil
 	}
 }
 
-func executeNextStep(config MigrationConfig, plan *MigrationPlan, stepIndex int) tea.Cmd {
+func waitForPlanUpdate(updates <-chan tea.Msg) tea.Cmd {
 	return func() tea.Msg {
-		time.Sleep(2 * time.Second) // Simulate step execution time
-		
-		if stepIndex >= len(plan.TodoList) {
-			return migrationCompleteMsg{nil}
-		}
-		
-		step := plan.TodoList[stepIndex]
-		var details string
-		var err error
-		
-		switch stepIndex {
-		case 0: // Backup step
-			details = "✓ System data backed up successfully"
-		case 1: // Validation step
-			details = "✓ Data integrity validated - no issues found"
-		case 2: // Begin migration
-			details = "✓ Started migration in priority order"
-		case 3: // User migration
-			details = fmt.Sprintf("✓ Migrated %d users according to Engine Room AI's recommendations", len(plan.RecommendedOrder))
-		case 4: // Phone number migration
-			details = "✓ Phone numbers and capabilities migrated"
-		case 5: // Final validation
-			details = "✓ Post-migration validation completed"
-		default:
-			if stepIndex == len(plan.TodoList)-1 {
-				// Final step - actually perform the migration
-				err = performActualMigration(config, plan)
-				if err == nil {
-					details = "✓ Migration file generated successfully"
-				}
-			} else {
-				details = fmt.Sprintf("✓ %s completed", step.Description)
-			}
-		}
-		
-		return stepCompleteMsg{stepIndex + 1, details, err}
+		return <-updates
 	}
 }
 
-func performActualMigration(config MigrationConfig, plan *MigrationPlan) error {
-	// Read source file
+// progressBar draws done out of total as a fixed-width bar.
+func progressBar(done, total, width int) string {
+	if total <= 0 {
+		return ""
+	}
+	filled := width * done / total
+	return "[" + strings.Repeat("█", filled) + strings.Repeat("░", width-filled) + "]"
+}
+
+// decodeSourceFile reads the source file in whatever format it is in.
+func decodeSourceFile(config MigrationConfig) (*CanonicalPhoneSystem, error) {
 	sourceData, err := ioutil.ReadFile(config.SourceFile)
 	if err != nil {
-		return fmt.Errorf("failed to read source file: %w", err)
+		return nil, fmt.Errorf("failed to read source file: %w", err)
 	}
 
-	// Parse source data
-	var twilioSystem TwilioPhoneSystem
-	if err := json.Unmarshal(sourceData, &twilioSystem); err != nil {
-		return fmt.Errorf("failed to parse source data: %w", err)
+	adapter, err := GetAdapter(config.SourceFormat)
+	if err != nil {
+		return nil, err
 	}
-
-	// Reorder users based on Engine Room AI's recommendations
-	var orderedUsers []TwilioUser
-	for _, item := range plan.RecommendedOrder {
-		orderedUsers = append(orderedUsers, item.Account)
+	system, err := adapter.Decode(sourceData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse source data: %w", err)
 	}
-	twilioSystem.Users = orderedUsers
+	return system, nil
+}
 
-	// Create enhanced output with Engine Room AI's insights
-	enhancedOutput := map[string]interface{}{
-		"migration_plan":     plan,
-		"converted_data":     nil, // Will be filled below
-		"migration_metadata": map[string]interface{}{
-			"enhanced_by":    "Engine Room AI",
-			"migration_time": time.Now().Format("2006-01-02 15:04:05"),
-			"source_format":  config.SourceFormat,
-			"target_format":  config.TargetFormat,
-			"execution_mode": "step-by-step",
-		},
+// buildMigrationPlan generates the plan for the configured source. progress,
+// if not nil, is called as each chunk of a large AI plan is finished.
+func buildMigrationPlan(ctx context.Context, config MigrationConfig, progress func(PlanProgress)) (*MigrationPlan, error) {
+	system, err := decodeSourceFile(config)
+	if err != nil {
+		return nil, err
 	}
 
-	// Convert to target format
-	if config.SourceFormat == "Twilio" && config.TargetFormat == "RingCentral" {
-		rcSystem := convertTwilioToRingCentral(twilioSystem)
-		enhancedOutput["converted_data"] = rcSystem
-	} else {
-		return fmt.Errorf("Engine Room AI-enhanced migration currently only supports Twilio to RingCentral")
+	// Fall back to the offline planner when AI is off or unavailable
+	llmErr := config.LLM.Check()
+	if !config.UseAI || llmErr != nil {
+		plan := OfflinePlanner{}.PlanMigrationOrder(system)
+		if config.UseAI {
+			plan.Reasoning = fmt.Sprintf("Engine Room AI unavailable (%v) - fell back to the offline planner. ", llmErr) + plan.Reasoning
+		}
+		return plan, nil
 	}
 
-	// Write enhanced output
-	targetData, err := json.MarshalIndent(enhancedOutput, "", "  ")
+	// Get Engine Room AI's migration plan
+	engineRoomMigrator, err := NewEngineRoomEnhancedMigrator(config.LLM)
 	if err != nil {
-		return fmt.Errorf("failed to marshal output: %w", err)
+		return nil, err
 	}
-
-	err = ioutil.WriteFile(config.TargetFile, targetData, 0644)
+	engineRoomMigrator.onProgress = progress
+	plan, err := engineRoomMigrator.PlanMigrationOrder(ctx, system, config.TargetFormat)
 	if err != nil {
-		return fmt.Errorf("failed to write target file: %w", err)
+		return nil, fmt.Errorf("Engine Room AI analysis failed: %w", err)
 	}
+	reconcilePlan(plan, system.Users)
+	reconcileNumberPlan(plan, system.Numbers, config.TargetFormat)
 
-	return nil
+	return plan, nil
 }
 
-func (m model) initializeExecutionSteps() model {
-	if m.migrationPlan != nil && len(m.migrationPlan.TodoList) > 0 {
-		m.executionSteps = make([]ExecutionStep, len(m.migrationPlan.TodoList))
-		for i, todo := range m.migrationPlan.TodoList {
-			m.executionSteps[i] = ExecutionStep{
-				StepNumber:  todo.Step,
-				Description: todo.Description,
-				Status:      "pending",
-			}
+func executeStep(run *migrationRun, step ExecutionStep, stepIndex int) tea.Cmd {
+	return func() tea.Msg {
+		executor, ok := stepExecutors[step.Executor]
+		if !ok {
+			return stepCompleteMsg{stepIndex + 1, "", fmt.Errorf("no executor for step %d (%s)", step.StepNumber, step.Executor)}
 		}
-		// Mark first step as running
-		if len(m.executionSteps) > 0 {
-			m.executionSteps[0].Status = "running"
+
+		details, err := executor(run, TodoItem{
+			Step:        step.StepNumber,
+			Description: step.Description,
+			Action:      step.Action,
+		})
+		return stepCompleteMsg{stepIndex + 1, details, err}
+	}
+}
+
+// startCurrentStep runs the step at currentStep, pauses on manual steps until
+// the user acknowledges them, and finishes the run after the last step.
+func (m model) startCurrentStep() (model, tea.Cmd) {
+	if m.currentStep >= len(m.executionSteps) {
+		// All steps completed
+		m.state = completed
+		m.migrationDone = true
+		return m.removeCheckpoint(), nil
+	}
+
+	step := &m.executionSteps[m.currentStep]
+	if step.Executor == executorManual {
+		step.Status = "awaiting"
+		return m.saveCheckpoint(), nil
+	}
+	if m.needsApproval(*step) {
+		step.Status = "approval"
+		return m.saveCheckpoint(), nil
+	}
+
+	// Save before the step starts changing the run
+	step.Status = "running"
+	m = m.saveCheckpoint()
+	return m, executeStep(m.run, *step, m.currentStep)
+}
+
+// enterTarget asks for the target filename, keeping the one entered before.
+func (m model) enterTarget() model {
+	m.state = enteringTarget
+	m.textInput.SetValue(m.config.TargetFile)
+	m.textInput.Placeholder = "Enter target filename..."
+	m.textInput.Focus()
+	return m
+}
+
+// startPlanning generates the plan with Engine Room AI or the offline
+// planner, as configured.
+func (m model) startPlanning() (model, tea.Cmd) {
+	m.state = showingPlan
+	m.planProgress = nil
+	m.planUpdates = make(chan tea.Msg)
+	return m, tea.Batch(
+		m.spinner.Tick,
+		generateMigrationPlan(m.ctx, m.config, m.planUpdates),
+		waitForPlanUpdate(m.planUpdates),
+	)
+}
+
+// startStandardMigration converts the data without a plan.
+func (m model) startStandardMigration() (model, tea.Cmd) {
+	m.state = executingPlan
+	return m, tea.Batch(
+		m.spinner.Tick,
+		performMigration(m.ctx, m.config),
+	)
+}
+
+func (m model) initializeExecutionSteps() model {
+	m.executionSteps = nil
+	if m.migrationPlan == nil {
+		return m
+	}
+
+	writes := false
+	for _, todo := range m.migrationPlan.TodoList {
+		executor := resolveStepExecutor(todo)
+		if executor == executorWrite {
+			writes = true
 		}
+		m.executionSteps = append(m.executionSteps, ExecutionStep{
+			StepNumber:  todo.Step,
+			Description: todo.Description,
+			Action:      todo.Action,
+			Executor:    executor,
+			Risk:        todo.Risk,
+			Status:      "pending",
+		})
+	}
+
+	// Every run must end with the output written, even if the plan forgot it
+	if !writes {
+		m.executionSteps = append(m.executionSteps, ExecutionStep{
+			StepNumber:  len(m.executionSteps) + 1,
+			Description: "Write migration output",
+			Action:      "Write the converted data and migration plan to the target file",
+			Executor:    executorWrite,
+			Status:      "pending",
+		})
 	}
 	return m
 }
 
-func performMigration(config MigrationConfig) tea.Cmd {
+func performMigration(ctx context.Context, config MigrationConfig) tea.Cmd {
 	return func() tea.Msg {
 		var err error
 		if config.UseAI {
-			err = migrateWithEngineRoom(config)
+			err = migrateWithEngineRoom(ctx, config)
 		} else {
 			err = migrate(config)
 		}
@@ -952,69 +1291,87 @@ func performMigration(config MigrationConfig) tea.Cmd {
 	}
 }
 
-func migrateWithEngineRoom(config MigrationConfig) error {
-	// Get Engine Room API key from environment
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
-	if apiKey == "" {
-		return fmt.Errorf("ANTHROPIC_API_KEY environment variable not set")
-	}
-
+func migrateWithEngineRoom(ctx context.Context, config MigrationConfig) error {
 	// Read source file
 	sourceData, err := ioutil.ReadFile(config.SourceFile)
 	if err != nil {
 		return fmt.Errorf("failed to read source file: %w", err)
 	}
 
-	// Parse source data
-	var twilioSystem TwilioPhoneSystem
-	if err := json.Unmarshal(sourceData, &twilioSystem); err != nil {
+	// Parse source data in whatever format it is in
+	sourceAdapter, err := GetAdapter(config.SourceFormat)
+	if err != nil {
+		return err
+	}
+	targetAdapter, err := GetAdapter(config.TargetFormat)
+	if err != nil {
+		return err
+	}
+	system, err := sourceAdapter.Decode(sourceData)
+	if err != nil {
 		return fmt.Errorf("failed to parse source data: %w", err)
 	}
+	validation, err := ValidateSource(config.SourceFormat, sourceData)
+	if err != nil {
+		return err
+	}
 
 	// Initialize Engine Room AI migrator
-	engineRoomMigrator := NewEngineRoomEnhancedMigrator(apiKey)
+	engineRoomMigrator, err := NewEngineRoomEnhancedMigrator(config.LLM)
+	if err != nil {
+		return err
+	}
 
 	// Get Engine Room AI's analysis and recommendations
-	plan, err := engineRoomMigrator.PlanMigrationOrder(twilioSystem.Users)
+	plan, err := engineRoomMigrator.PlanMigrationOrder(ctx, system, targetAdapter.Name())
 	if err != nil {
 		return fmt.Errorf("Engine Room AI analysis failed: %w", err)
 	}
 
 	// Get data quality analysis
-	qualityAnalysis, err := engineRoomMigrator.AnalyzeDataQuality(twilioSystem.Users)
+	qualityAnalysis, err := engineRoomMigrator.AnalyzeDataQuality(ctx, system)
 	if err != nil {
 		log.Printf("Data quality analysis failed: %v", err)
 	}
 
+	unmapped := unmappedCapabilities(system, targetAdapter.Name())
+
+	// Reorder users and numbers based on the plan, reconciled against the
+	// source records
+	system.Users = reconcilePlan(plan, system.Users)
+	system.Numbers = reconcileNumberPlan(plan, system.Numbers, targetAdapter.Name())
+
+	// Convert to target format
+	convertedData, err := targetAdapter.Encode(system)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s data: %w", targetAdapter.Name(), err)
+	}
+	rollback, err := newRollbackRecord(config, sourceData, convertedData)
+	if err != nil {
+		return err
+	}
+
 	// Create enhanced output with Engine Room AI's insights
 	enhancedOutput := map[string]interface{}{
 		"migration_plan":     plan,
 		"data_quality":       qualityAnalysis,
-		"original_data":      twilioSystem,
-		"converted_data":     nil, // Will be filled below
+		"validation_report":  validation,
+		"original_data":      json.RawMessage(sourceData),
+		"converted_data":     json.RawMessage(convertedData),
+		"rollback":           rollback,
 		"migration_metadata": map[string]interface{}{
-			"enhanced_by":    "Engine Room AI",
-			"migration_time": time.Now().Format("2006-01-02 15:04:05"),
-			"source_format":  config.SourceFormat,
-			"target_format":  config.TargetFormat,
+			"enhanced_by":           "Engine Room AI",
+			"migration_time":        time.Now().Format("2006-01-02 15:04:05"),
+			"source_format":         sourceAdapter.Name(),
+			"target_format":         targetAdapter.Name(),
+			"reconciliation":        plan.Reconciliation,
+			"unmapped_capabilities": unmapped,
+			"redaction":             engineRoomMigrator.redaction.Describe(),
+			"redaction_key_id":      plan.RedactionKeyID,
+			"engine_room_usage":     engineRoomMigrator.Usage(),
 		},
 	}
 
-	// Reorder users based on Engine Room AI's recommendations
-	var orderedUsers []TwilioUser
-	for _, item := range plan.RecommendedOrder {
-		orderedUsers = append(orderedUsers, item.Account)
-	}
-	twilioSystem.Users = orderedUsers
-
-	// Convert to target format
-	if config.SourceFormat == "Twilio" && config.TargetFormat == "RingCentral" {
-		rcSystem := convertTwilioToRingCentral(twilioSystem)
-		enhancedOutput["converted_data"] = rcSystem
-	} else {
-		return fmt.Errorf("Engine Room AI-enhanced migration currently only supports Twilio to RingCentral")
-	}
-
 	// Write enhanced output
 	targetData, err := json.MarshalIndent(enhancedOutput, "", "  ")
 	if err != nil {
@@ -1036,23 +1393,23 @@ func migrate(config MigrationConfig) error {
 		return fmt.Errorf("failed to read source file: %w", err)
 	}
 
-	// Parse based on source format and convert to target format
+	// Convert through the canonical model using the registered adapters
 	var targetData []byte
 	
-	if config.SourceFormat == "Twilio" && config.TargetFormat == "RingCentral" {
-		targetData, err = twilioToRingCentral(sourceData)
-	} else if config.SourceFormat == "RingCentral" && config.TargetFormat == "Twilio" {
-		targetData, err = ringCentralToTwilio(sourceData)
-	} else if config.SourceFormat == config.TargetFormat {
+	if config.SourceFormat == config.TargetFormat {
 		// Same format, just copy
 		targetData = sourceData
 	} else {
-		return fmt.Errorf("unsupported migration path: %s to %s", config.SourceFormat, config.TargetFormat)
+		targetData, err = convertBetween(config.SourceFormat, config.TargetFormat, sourceData)
 	}
 
 	if err != nil {
 		return fmt.Errorf("migration failed: %w", err)
 	}
+	rollback, err := newRollbackRecord(config, sourceData, targetData)
+	if err != nil {
+		return err
+	}
 
 	// Write target file
 	err = ioutil.WriteFile(config.TargetFile, targetData, 0644)
@@ -1060,103 +1417,39 @@ func migrate(config MigrationConfig) error {
 		return fmt.Errorf("failed to write target file: %w", err)
 	}
 
-	return nil
-}
-
-func convertTwilioToRingCentral(twilioSystem TwilioPhoneSystem) RingCentralPhoneSystem {
-	var rcSystem RingCentralPhoneSystem
-	
-	// Convert users to accounts
-	for _, user := range twilioSystem.Users {
-		account := RingCentralAccount{
-			ID:         user.ID,
-			Username:   user.Name,
-			Contact:    user.Email,
-			MainNumber: user.PhoneNumber,
-			Active:     user.Status == "active",
-		}
-		rcSystem.Accounts = append(rcSystem.Accounts, account)
-	}
-
-	// Convert lines to numbers
-	for _, line := range twilioSystem.Lines {
-		var features []string
-		for capability, enabled := range line.Capabilities {
-			if enabled {
-				features = append(features, capability)
-			}
-		}
-		
-		number := RingCentralNumber{
-			ID:       line.SID,
-			Number:   line.Number,
-			Features: features,
-			Region:   line.Location,
-		}
-		rcSystem.Numbers = append(rcSystem.Numbers, number)
-	}
-
-	return rcSystem
-}
-
-func twilioToRingCentral(data []byte) ([]byte, error) {
-	var twilioSystem TwilioPhoneSystem
-	if err := json.Unmarshal(data, &twilioSystem); err != nil {
-		return nil, err
+	// The target holds only converted data, so the rollback record goes beside it
+	if err := writeRollbackFile(rollback, sourceData); err != nil {
+		return fmt.Errorf("failed to write rollback record: %w", err)
 	}
 
-	rcSystem := convertTwilioToRingCentral(twilioSystem)
-	return json.MarshalIndent(rcSystem, "", "  ")
+	return nil
 }
 
-func ringCentralToTwilio(data []byte) ([]byte, error) {
-	var rcSystem RingCentralPhoneSystem
-	if err := json.Unmarshal(data, &rcSystem); err != nil {
-		return nil, err
+func main() {
+	if err := loadCapabilityMappingsFromEnv(); err != nil {
+		log.Fatal(err)
 	}
-
-	// Convert RingCentral to Twilio format
-	var twilioSystem TwilioPhoneSystem
-	
-	// Convert accounts to users
-	for _, account := range rcSystem.Accounts {
-		status := "inactive"
-		if account.Active {
-			status = "active"
-		}
-		
-		user := TwilioUser{
-			ID:          account.ID,
-			Name:        account.Username,
-			Email:       account.Contact,
-			PhoneNumber: account.MainNumber,
-			Status:      status,
-		}
-		twilioSystem.Users = append(twilioSystem.Users, user)
+	if err := loadModelPricesFromEnv(); err != nil {
+		log.Fatal(err)
 	}
 
-	// Convert numbers to lines
-	for _, number := range rcSystem.Numbers {
-		capabilities := make(map[string]bool)
-		for _, feature := range number.Features {
-			capabilities[feature] = true
+	start := initialModel()
+	if len(os.Args) > 1 && os.Args[1] == "resume" {
+		path := defaultCheckpointFile
+		if len(os.Args) > 2 {
+			path = os.Args[2]
 		}
-		
-		line := TwilioLine{
-			SID:          number.ID,
-			Number:       number.Number,
-			Capabilities: capabilities,
-			Location:     number.Region,
+		resumed, err := resumedModel(path)
+		if err != nil {
+			log.Fatal(err)
 		}
-		twilioSystem.Lines = append(twilioSystem.Lines, line)
+		start = resumed
+	} else if len(os.Args) > 1 {
+		os.Exit(runCLI(os.Args[1:]))
 	}
 
-	return json.MarshalIndent(twilioSystem, "", "  ")
-}
-
-func main() {
-	p := tea.NewProgram(initialModel(), tea.WithAltScreen())
+	p := tea.NewProgram(start, tea.WithAltScreen(), tea.WithMouseCellMotion())
 	if _, err := p.Run(); err != nil {
 		log.Fatal(err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Kinds of change made to a plan in the editor
+const (
+	editMovedAccount    = "moved_account"
+	editExcludedAccount = "excluded_account"
+	editAccountRisk     = "account_risk_changed"
+	editAddedStep       = "added_step"
+	editRemovedStep     = "removed_step"
+	editMovedStep       = "moved_step"
+	editStepRisk        = "step_risk_changed"
+)
+
+// PlanEdit is one difference between the generated plan and the plan the
+// user approved.
+type PlanEdit struct {
+	Kind    string `json:"kind"`
+	Subject string `json:"subject"` // account ID or to-do step description
+	Detail  string `json:"detail"`
+}
+
+// Sections of the plan editor
+const (
+	editingUsers = iota
+	editingSteps
+)
+
+// Text prompts of the plan editor
+const (
+	editPromptPriority = "priority"
+	editPromptStep     = "step"
+)
+
+// clone copies a plan so it can be edited without changing the original.
+func (p *MigrationPlan) clone() *MigrationPlan {
+	clone := *p
+	clone.RecommendedOrder = append([]AccountWithPriority(nil), p.RecommendedOrder...)
+	clone.Excluded = append([]AccountWithPriority(nil), p.Excluded...)
+	clone.TodoList = append([]TodoItem(nil), p.TodoList...)
+	clone.NumberPlan = append([]NumberWithPriority(nil), p.NumberPlan...)
+	clone.Reconciliation = append([]PlanDiscrepancy(nil), p.Reconciliation...)
+	clone.Edits = append([]PlanEdit(nil), p.Edits...)
+	return &clone
+}
+
+// renumber makes priorities follow the recommended order and steps follow
+// the to-do list, as the executor runs them in list order.
+func (p *MigrationPlan) renumber() {
+	for i := range p.RecommendedOrder {
+		p.RecommendedOrder[i].Priority = i + 1
+	}
+	for i := range p.TodoList {
+		p.TodoList[i].Step = i + 1
+	}
+}
+
+// moveAccount moves the account at from to position to in the recommended
+// order.
+func (p *MigrationPlan) moveAccount(from, to int) {
+	if from < 0 || from >= len(p.RecommendedOrder) || to < 0 || to >= len(p.RecommendedOrder) {
+		return
+	}
+	item := p.RecommendedOrder[from]
+	order := append(p.RecommendedOrder[:from:from], p.RecommendedOrder[from+1:]...)
+	order = append(order[:to:to], append([]AccountWithPriority{item}, order[to:]...)...)
+	p.RecommendedOrder = order
+	p.renumber()
+}
+
+// toggleExcluded moves an account between the recommended order and the
+// excluded list. index counts the recommended order first, then the
+// excluded accounts. Re-included accounts go to the end of the order.
+func (p *MigrationPlan) toggleExcluded(index int) {
+	if index < len(p.RecommendedOrder) {
+		p.Excluded = append(p.Excluded, p.RecommendedOrder[index])
+		p.RecommendedOrder = append(p.RecommendedOrder[:index:index], p.RecommendedOrder[index+1:]...)
+	} else if index -= len(p.RecommendedOrder); index < len(p.Excluded) {
+		p.RecommendedOrder = append(p.RecommendedOrder, p.Excluded[index])
+		p.Excluded = append(p.Excluded[:index:index], p.Excluded[index+1:]...)
+	}
+	p.renumber()
+}
+
+func (p *MigrationPlan) moveStep(from, to int) {
+	if from < 0 || from >= len(p.TodoList) || to < 0 || to >= len(p.TodoList) {
+		return
+	}
+	p.TodoList[from], p.TodoList[to] = p.TodoList[to], p.TodoList[from]
+	p.renumber()
+}
+
+// insertStep adds a step after index. The executor is left for
+// resolveStepExecutor to infer from the description.
+func (p *MigrationPlan) insertStep(index int, description string) {
+	todo := TodoItem{Description: description, Action: description, Risk: "low"}
+	index++
+	if index > len(p.TodoList) {
+		index = len(p.TodoList)
+	}
+	p.TodoList = append(p.TodoList[:index:index], append([]TodoItem{todo}, p.TodoList[index:]...)...)
+	p.renumber()
+}
+
+func (p *MigrationPlan) removeStep(index int) {
+	if index < 0 || index >= len(p.TodoList) {
+		return
+	}
+	p.TodoList = append(p.TodoList[:index:index], p.TodoList[index+1:]...)
+	p.renumber()
+}
+
+// nextRisk cycles low, medium, high.
+func nextRisk(risk string) string {
+	for i, level := range planRiskLevels {
+		if level == risk {
+			return planRiskLevels[(i+1)%len(planRiskLevels)]
+		}
+	}
+	return planRiskLevels[0]
+}
+
+// excludedIDs returns the IDs of the accounts left out of the migration.
+func (p *MigrationPlan) excludedIDs() map[string]bool {
+	ids := make(map[string]bool, len(p.Excluded))
+	for _, item := range p.Excluded {
+		ids[item.Account.ID] = true
+	}
+	return ids
+}
+
+// diffPlans lists the changes from original to edited. A move is reported
+// only for entries whose order relative to the others changed, so moving one
+// account does not report every account it shifted.
+func diffPlans(original, edited *MigrationPlan) []PlanEdit {
+	var edits []PlanEdit
+
+	originalAccounts := make(map[string]int, len(original.RecommendedOrder))
+	for i, item := range original.RecommendedOrder {
+		originalAccounts[item.Account.ID] = i
+	}
+	var kept []int
+	var positions []int
+	for i, item := range edited.RecommendedOrder {
+		if pos, ok := originalAccounts[item.Account.ID]; ok {
+			kept = append(kept, i)
+			positions = append(positions, pos)
+		}
+	}
+	moved := outOfOrder(positions)
+	for k, i := range kept {
+		item := edited.RecommendedOrder[i]
+		before := original.RecommendedOrder[positions[k]]
+		if moved[k] {
+			edits = append(edits, PlanEdit{
+				Kind:    editMovedAccount,
+				Subject: item.Account.ID,
+				Detail:  fmt.Sprintf("%s moved from position %d to %d", item.Account.Name, positions[k]+1, i+1),
+			})
+		}
+		if before.Risk != item.Risk {
+			edits = append(edits, PlanEdit{
+				Kind:    editAccountRisk,
+				Subject: item.Account.ID,
+				Detail:  fmt.Sprintf("%s risk changed from %s to %s", item.Account.Name, before.Risk, item.Risk),
+			})
+		}
+	}
+	for _, item := range edited.Excluded {
+		if _, ok := originalAccounts[item.Account.ID]; ok {
+			edits = append(edits, PlanEdit{
+				Kind:    editExcludedAccount,
+				Subject: item.Account.ID,
+				Detail:  fmt.Sprintf("%s excluded from the migration", item.Account.Name),
+			})
+		}
+	}
+
+	stepKey := func(todo TodoItem) string { return todo.Description + "\x00" + todo.Action }
+	originalSteps := make(map[string]int, len(original.TodoList))
+	for i, todo := range original.TodoList {
+		originalSteps[stepKey(todo)] = i
+	}
+	editedSteps := make(map[string]bool, len(edited.TodoList))
+	kept, positions = nil, nil
+	for i, todo := range edited.TodoList {
+		editedSteps[stepKey(todo)] = true
+		if pos, ok := originalSteps[stepKey(todo)]; ok {
+			kept = append(kept, i)
+			positions = append(positions, pos)
+		} else {
+			edits = append(edits, PlanEdit{
+				Kind:    editAddedStep,
+				Subject: todo.Description,
+				Detail:  fmt.Sprintf("added as step %d", i+1),
+			})
+		}
+	}
+	for i, todo := range original.TodoList {
+		if !editedSteps[stepKey(todo)] {
+			edits = append(edits, PlanEdit{
+				Kind:    editRemovedStep,
+				Subject: todo.Description,
+				Detail:  fmt.Sprintf("step %d removed", i+1),
+			})
+		}
+	}
+	moved = outOfOrder(positions)
+	for k, i := range kept {
+		todo := edited.TodoList[i]
+		before := original.TodoList[positions[k]]
+		if moved[k] {
+			edits = append(edits, PlanEdit{
+				Kind:    editMovedStep,
+				Subject: todo.Description,
+				Detail:  fmt.Sprintf("moved from step %d to %d", positions[k]+1, i+1),
+			})
+		}
+		if before.Risk != todo.Risk {
+			edits = append(edits, PlanEdit{
+				Kind:    editStepRisk,
+				Subject: todo.Description,
+				Detail:  fmt.Sprintf("risk changed from %s to %s", before.Risk, todo.Risk),
+			})
+		}
+	}
+	return edits
+}
+
+// outOfOrder returns the indexes of positions that are not part of its
+// longest increasing subsequence, i.e. the fewest entries that must have
+// moved to turn the original order into this one.
+func outOfOrder(positions []int) map[int]bool {
+	var tails []int // tails[k] ends the best increasing run of length k+1
+	prev := make([]int, len(positions))
+	for i, pos := range positions {
+		k := sort.Search(len(tails), func(k int) bool { return positions[tails[k]] >= pos })
+		prev[i] = -1
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	inOrder := make(map[int]bool, len(tails))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			inOrder[i] = true
+		}
+	}
+	moved := make(map[int]bool)
+	for i := range positions {
+		if !inOrder[i] {
+			moved[i] = true
+		}
+	}
+	return moved
+}
+
+// startEditingPlan opens the plan editor, keeping the generated plan to
+// diff against on the first edit.
+func (m model) startEditingPlan() model {
+	if m.originalPlan == nil {
+		m.originalPlan = m.migrationPlan.clone()
+		m.migrationPlan = m.migrationPlan.clone()
+	}
+	m.state = editingPlan
+	m.editSection = editingUsers
+	m.editCursor = 0
+	m.editPrompt = ""
+	return m
+}
+
+// finishEditingPlan records the edits and returns to the confirmation. Edits
+// made before the latest revision stay recorded on originalPlan.
+func (m model) finishEditingPlan() model {
+	edits := append([]PlanEdit(nil), m.originalPlan.Edits...)
+	m.migrationPlan.Edits = append(edits, diffPlans(m.originalPlan, m.migrationPlan)...)
+	m.state = confirmingPlan
+	return m
+}
+
+// editRows is the number of rows the cursor can move over in the current
+// section.
+func (m model) editRows() int {
+	if m.editSection == editingSteps {
+		return len(m.migrationPlan.TodoList)
+	}
+	return len(m.migrationPlan.RecommendedOrder) + len(m.migrationPlan.Excluded)
+}
+
+func (m model) updatePlanEditor(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	plan := m.migrationPlan
+
+	if m.editPrompt != "" {
+		switch msg.String() {
+		case "ctrl+c":
+			return m.quit()
+		case "esc":
+			m.editPrompt = ""
+			m.textInput.SetValue("")
+			return m, nil
+		case "enter":
+			value := strings.TrimSpace(m.textInput.Value())
+			switch m.editPrompt {
+			case editPromptPriority:
+				if priority, err := strconv.Atoi(value); err == nil && priority >= 1 && priority <= len(plan.RecommendedOrder) {
+					plan.moveAccount(m.editCursor, priority-1)
+					m.editCursor = priority - 1
+				}
+			case editPromptStep:
+				if value != "" {
+					plan.insertStep(m.editCursor, value)
+					if len(plan.TodoList) > 1 {
+						m.editCursor++
+					}
+				}
+			}
+			m.editPrompt = ""
+			m.textInput.SetValue("")
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.textInput, cmd = m.textInput.Update(msg)
+		return m, cmd
+	}
+
+	included := m.editSection == editingUsers && m.editCursor < len(plan.RecommendedOrder)
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m.quit()
+	case "esc", "enter":
+		return m.finishEditingPlan(), nil
+	case "tab":
+		m.editSection = (m.editSection + 1) % 2
+		m.editCursor = 0
+	case "up", "k":
+		if m.editCursor > 0 {
+			m.editCursor--
+		}
+	case "down", "j":
+		if m.editCursor < m.editRows()-1 {
+			m.editCursor++
+		}
+	case "K", "shift+up":
+		if m.editSection == editingSteps && m.editCursor > 0 {
+			plan.moveStep(m.editCursor, m.editCursor-1)
+			m.editCursor--
+		} else if included && m.editCursor > 0 {
+			plan.moveAccount(m.editCursor, m.editCursor-1)
+			m.editCursor--
+		}
+	case "J", "shift+down":
+		if m.editSection == editingSteps && m.editCursor < len(plan.TodoList)-1 {
+			plan.moveStep(m.editCursor, m.editCursor+1)
+			m.editCursor++
+		} else if included && m.editCursor < len(plan.RecommendedOrder)-1 {
+			plan.moveAccount(m.editCursor, m.editCursor+1)
+			m.editCursor++
+		}
+	case "r":
+		if m.editSection == editingSteps && m.editCursor < len(plan.TodoList) {
+			plan.TodoList[m.editCursor].Risk = nextRisk(plan.TodoList[m.editCursor].Risk)
+		} else if included {
+			plan.RecommendedOrder[m.editCursor].Risk = nextRisk(plan.RecommendedOrder[m.editCursor].Risk)
+		}
+	case "p":
+		if included {
+			m.editPrompt = editPromptPriority
+			m.textInput.SetValue("")
+			m.textInput.Placeholder = fmt.Sprintf("New priority (1-%d)...", len(plan.RecommendedOrder))
+			m.textInput.Focus()
+		}
+	case "x":
+		if m.editSection == editingUsers && m.editCursor < m.editRows() {
+			plan.toggleExcluded(m.editCursor)
+		}
+	case "a":
+		if m.editSection == editingSteps {
+			m.editPrompt = editPromptStep
+			m.textInput.SetValue("")
+			m.textInput.Placeholder = "Describe the new step..."
+			m.textInput.Focus()
+		}
+	case "d":
+		if m.editSection == editingSteps && m.editCursor < len(plan.TodoList) {
+			plan.removeStep(m.editCursor)
+			if m.editCursor > 0 && m.editCursor >= len(plan.TodoList) {
+				m.editCursor--
+			}
+		}
+	case "u":
+		m.migrationPlan = m.originalPlan.clone()
+		m.editCursor = 0
+	}
+	return m, nil
+}
+
+func (m model) planEditorView() string {
+	var s strings.Builder
+	plan := m.migrationPlan
+
+	s.WriteString(aiStyle.Render("✏️  Edit Migration Plan"))
+	s.WriteString("\n\n")
+
+	cursor := func(section, row int) string {
+		if m.editSection == section && m.editCursor == row {
+			return ">"
+		}
+		return " "
+	}
+
+	s.WriteString(subtitleStyle.Render("👥 User Migration Order:"))
+	s.WriteString("\n")
+	for i, item := range plan.RecommendedOrder {
+		s.WriteString(fmt.Sprintf("%s %d. %s %s (%s) [%s risk]\n",
+			cursor(editingUsers, i), item.Priority, riskEmoji(item.Risk), item.Account.Name, item.Account.ID, item.Risk))
+	}
+	for i, item := range plan.Excluded {
+		s.WriteString(stepPendingStyle.Render(fmt.Sprintf("%s -. %s (%s) [excluded]",
+			cursor(editingUsers, len(plan.RecommendedOrder)+i), item.Account.Name, item.Account.ID)))
+		s.WriteString("\n")
+	}
+	s.WriteString("\n")
+
+	s.WriteString(subtitleStyle.Render("✅ Migration To-Do List:"))
+	s.WriteString("\n")
+	for i, todo := range plan.TodoList {
+		s.WriteString(fmt.Sprintf("%s %d. %s %s [%s]\n",
+			cursor(editingSteps, i), todo.Step, riskEmoji(todo.Risk), todo.Description, resolveStepExecutor(todo)))
+	}
+	s.WriteString("\n")
+
+	if m.editPrompt != "" {
+		s.WriteString(m.textInput.View())
+		s.WriteString("\n\n")
+		s.WriteString(helpStyle.Render("Enter to apply, Esc to cancel"))
+		return s.String()
+	}
+
+	if m.editSection == editingSteps {
+		s.WriteString(helpStyle.Render("↑/↓ select • K/J move • r risk • a add after • d delete • Tab users • u undo all • Enter done"))
+	} else {
+		s.WriteString(helpStyle.Render("↑/↓ select • K/J move • p set priority • r risk • x exclude/include • Tab steps • u undo all • Enter done"))
+	}
+	return s.String()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testPlan has accounts a to e in order and three low-risk steps.
+func testPlan() *MigrationPlan {
+	plan := &MigrationPlan{}
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		plan.RecommendedOrder = append(plan.RecommendedOrder, AccountWithPriority{
+			Account: CanonicalUser{ID: id, Name: "User " + id},
+			Risk:    "low",
+		})
+	}
+	for _, description := range []string{"Back up", "Convert", "Write"} {
+		plan.TodoList = append(plan.TodoList, TodoItem{Description: description, Action: description, Risk: "low"})
+	}
+	plan.renumber()
+	return plan
+}
+
+func TestDiffPlans(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(plan *MigrationPlan)
+		want []string // kind subject: detail
+	}{
+		{
+			name: "unchanged",
+			edit: func(plan *MigrationPlan) {},
+		},
+		{
+			name: "moving one account reports only that account",
+			edit: func(plan *MigrationPlan) { plan.moveAccount(4, 0) },
+			want: []string{"moved_account e: User e moved from position 5 to 1"},
+		},
+		{
+			name: "swapping neighbours reports one of them",
+			edit: func(plan *MigrationPlan) { plan.moveAccount(1, 2) },
+			want: []string{"moved_account c: User c moved from position 3 to 2"},
+		},
+		{
+			name: "reversing keeps the longest ordered run",
+			edit: func(plan *MigrationPlan) {
+				plan.moveAccount(4, 0)
+				plan.moveAccount(4, 1)
+				plan.moveAccount(4, 2)
+				plan.moveAccount(4, 3)
+			},
+			want: []string{
+				"moved_account e: User e moved from position 5 to 1",
+				"moved_account d: User d moved from position 4 to 2",
+				"moved_account c: User c moved from position 3 to 3",
+				"moved_account b: User b moved from position 2 to 4",
+			},
+		},
+		{
+			name: "exclusion and risk",
+			edit: func(plan *MigrationPlan) {
+				plan.toggleExcluded(0)
+				plan.RecommendedOrder[0].Risk = "high"
+			},
+			want: []string{
+				"account_risk_changed b: User b risk changed from low to high",
+				"excluded_account a: User a excluded from the migration",
+			},
+		},
+		{
+			name: "steps",
+			edit: func(plan *MigrationPlan) {
+				plan.removeStep(0)
+				plan.insertStep(0, "Verify")
+				plan.moveStep(0, 2)
+				plan.TodoList[2].Risk = "medium"
+			},
+			want: []string{
+				"added_step Verify: added as step 2",
+				"removed_step Back up: step 1 removed",
+				"moved_step Write: moved from step 3 to 1",
+				"step_risk_changed Convert: risk changed from low to medium",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := testPlan()
+			edited := original.clone()
+			tt.edit(edited)
+
+			var got []string
+			for _, edit := range diffPlans(original, edited) {
+				got = append(got, edit.Kind+" "+edit.Subject+": "+edit.Detail)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffPlans = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutOfOrder(t *testing.T) {
+	tests := []struct {
+		positions []int
+		want      map[int]bool
+	}{
+		{nil, map[int]bool{}},
+		{[]int{0, 1, 2}, map[int]bool{}},
+		{[]int{2, 0, 1}, map[int]bool{0: true}},
+		{[]int{1, 2, 3, 0}, map[int]bool{3: true}},
+		{[]int{3, 2, 1, 0}, map[int]bool{0: true, 1: true, 2: true}},
+		{[]int{0, 4, 1, 2, 3}, map[int]bool{1: true}},
+	}
+	for _, tt := range tests {
+		if got := outOfOrder(tt.positions); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("outOfOrder(%v) = %v, want %v", tt.positions, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Plan generators recorded in MigrationPlan.GeneratedBy
+const (
+	planGeneratorEngineRoom = "Engine Room AI"
+	planGeneratorOffline    = "Offline planner"
+)
+
+// Local parts of email addresses that usually belong to admin or
+// operations accounts
+var adminEmailHints = []string{"admin", "root", "it", "ops", "noc", "helpdesk", "support", "telecom", "sysadmin"}
+
+// Planning tiers, migrated in ascending order
+const (
+	tierAdmin = iota
+	tierActive
+	tierNeedsReview
+	tierInactive
+)
+
+// OfflinePlanner builds a MigrationPlan from fixed rules, without any
+// network access. The same input always produces the same plan.
+type OfflinePlanner struct{}
+
+type plannedUser struct {
+	user   CanonicalUser
+	tier   int
+	risk   string
+	reason string
+}
+
+func (p OfflinePlanner) PlanMigrationOrder(system *CanonicalPhoneSystem) *MigrationPlan {
+	numbersByPhone := make(map[string]CanonicalNumber)
+	for _, number := range system.Numbers {
+		numbersByPhone[number.Number] = number
+	}
+
+	report := validateCanonical("", system)
+
+	var planned []plannedUser
+	issueCount := 0
+	for _, user := range system.Users {
+		entry := p.classifyUser(user, numbersByPhone, report)
+		if entry.tier == tierNeedsReview {
+			issueCount++
+		}
+		planned = append(planned, entry)
+	}
+
+	sort.SliceStable(planned, func(i, j int) bool {
+		if planned[i].tier != planned[j].tier {
+			return planned[i].tier < planned[j].tier
+		}
+		if planned[i].user.Name != planned[j].user.Name {
+			return planned[i].user.Name < planned[j].user.Name
+		}
+		return planned[i].user.ID < planned[j].user.ID
+	})
+
+	plan := &MigrationPlan{
+		GeneratedBy: planGeneratorOffline,
+	}
+	tierCounts := make(map[int]int)
+	for i, entry := range planned {
+		tierCounts[entry.tier]++
+		plan.RecommendedOrder = append(plan.RecommendedOrder, AccountWithPriority{
+			Account:  entry.user,
+			Priority: i + 1,
+			Reason:   entry.reason,
+			Risk:     entry.risk,
+		})
+	}
+
+	plan.Reasoning = fmt.Sprintf("Rule-based ordering: %d admin/operations account(s) first so the system stays manageable, "+
+		"then %d active account(s), then %d account(s) with data-quality issues that need review, and %d inactive account(s) last "+
+		"since they carry no live traffic. Ties are broken by name.",
+		tierCounts[tierAdmin], tierCounts[tierActive], tierCounts[tierNeedsReview], tierCounts[tierInactive])
+
+	plan.RiskAssessment = p.assessRisk(system, report, issueCount)
+	plan.TodoList = p.todoList(issueCount)
+	plan.EstimatedTime = p.estimateTime(system)
+
+	return plan
+}
+
+func (p OfflinePlanner) classifyUser(user CanonicalUser, numbersByPhone map[string]CanonicalNumber, report *ValidationReport) plannedUser {
+	var issues []string
+	for _, finding := range report.FindingsFor("user", user.ID) {
+		if finding.Severity != severityInfo {
+			issues = append(issues, finding.Message)
+		}
+	}
+	if len(issues) > 0 {
+		return plannedUser{
+			user:   user,
+			tier:   tierNeedsReview,
+			risk:   "high",
+			reason: "Data-quality issues need review before migration: " + strings.Join(issues, "; "),
+		}
+	}
+
+	if !user.IsActive() {
+		return plannedUser{
+			user:   user,
+			tier:   tierInactive,
+			risk:   "low",
+			reason: "Inactive account - migrated last since it carries no live traffic",
+		}
+	}
+
+	if looksLikeAdmin(user.Email) {
+		return plannedUser{
+			user:   user,
+			tier:   tierAdmin,
+			risk:   "low",
+			reason: "Admin-looking account - migrated first to maintain system management",
+		}
+	}
+
+	number := numbersByPhone[user.PhoneNumber]
+	if enabled := enabledCapabilities(number); len(enabled) > 2 {
+		return plannedUser{
+			user:   user,
+			tier:   tierActive,
+			risk:   "medium",
+			reason: fmt.Sprintf("Active account using %s - more features to verify after migration", strings.Join(enabled, ", ")),
+		}
+	}
+
+	return plannedUser{
+		user:   user,
+		tier:   tierActive,
+		risk:   "low",
+		reason: "Active account with a standard feature set",
+	}
+}
+
+func (OfflinePlanner) assessRisk(system *CanonicalPhoneSystem, report *ValidationReport, issueCount int) string {
+	var risks []string
+	if report.HasErrors() {
+		risks = append(risks, fmt.Sprintf("Validation found %d blocking error(s) that must be fixed before migration", report.Errors))
+	}
+	if issueCount > 0 {
+		risks = append(risks, fmt.Sprintf("%d account(s) have data-quality issues and are scheduled after healthy active accounts; fix them before cutover", issueCount))
+	}
+
+	faxOrMMS := 0
+	for _, number := range system.Numbers {
+		if number.Capabilities["fax"] || number.Capabilities["mms"] {
+			faxOrMMS++
+		}
+	}
+	if faxOrMMS > 0 {
+		risks = append(risks, fmt.Sprintf("%d number(s) use fax or MMS, which should be tested on the target system after migration", faxOrMMS))
+	}
+
+	if len(risks) == 0 {
+		return "Low risk: all accounts have complete data and standard feature sets. Keep the backup until the migrated data has been verified."
+	}
+	return strings.Join(risks, ". ") + ". Keep the backup until the migrated data has been verified."
+}
+
+func (OfflinePlanner) todoList(issueCount int) []TodoItem {
+	validationRisk := "low"
+	if issueCount > 0 {
+		validationRisk = "medium"
+	}
+
+	return []TodoItem{
+		{Step: 1, Description: "Backup current system data", Action: "Create a full backup of the source export", Risk: "low", Executor: executorBackup},
+		{Step: 2, Description: "Validate data integrity", Action: "Check for missing fields, invalid phone numbers and duplicate accounts", Risk: validationRisk, Executor: executorValidate},
+		{Step: 3, Description: "Begin migration in priority order", Action: "Order accounts according to the recommended migration order", Risk: "low", Executor: executorOrder},
+		{Step: 4, Description: "Migrate user accounts", Action: "Convert every user account to the target format", Risk: "medium", Executor: executorConvertUsers},
+		{Step: 5, Description: "Migrate phone numbers and capabilities", Action: "Convert phone numbers and their capabilities to the target format", Risk: "medium", Executor: executorConvertNumbers},
+		{Step: 6, Description: "Check round-trip fidelity", Action: "Convert to the target format and back, and report any field that is lost or altered", Risk: "low", Executor: executorRoundTrip},
+		{Step: 7, Description: "Post-migration validation", Action: "Verify every account and number is present in the converted data", Risk: "low", Executor: executorVerify},
+		{Step: 8, Description: "Write migration output", Action: "Write the converted data and migration plan to the target file", Risk: "high", Executor: executorWrite},
+	}
+}
+
+func (OfflinePlanner) estimateTime(system *CanonicalPhoneSystem) string {
+	// Two minutes of fixed overhead plus review time per record
+	seconds := 120 + 30*len(system.Users) + 15*len(system.Numbers)
+	minutes := (seconds + 59) / 60
+	return fmt.Sprintf("%d-%d minutes including validation steps", minutes, minutes+minutes/2+1)
+}
+
+func looksLikeAdmin(email string) bool {
+	local := strings.ToLower(email)
+	if at := strings.Index(local, "@"); at >= 0 {
+		local = local[:at]
+	}
+	for _, part := range strings.FieldsFunc(local, func(r rune) bool {
+		return r == '.' || r == '-' || r == '_' || r == '+'
+	}) {
+		for _, hint := range adminEmailHints {
+			if part == hint {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func enabledCapabilities(number CanonicalNumber) []string {
+	var enabled []string
+	for capability, on := range number.Capabilities {
+		if on {
+			enabled = append(enabled, capability)
+		}
+	}
+	sort.Strings(enabled)
+	return enabled
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func plannedIDs(plan *MigrationPlan) []string {
+	var ids []string
+	for _, entry := range plan.RecommendedOrder {
+		ids = append(ids, entry.Account.ID)
+	}
+	return ids
+}
+
+func TestOfflinePlannerTiers(t *testing.T) {
+	system := &CanonicalPhoneSystem{
+		Users: []CanonicalUser{
+			{ID: "u1", Name: "Zoe Old", Email: "zoe@example.com", PhoneNumber: "+15550000001", Status: "inactive"},
+			{ID: "u2", Name: "Bob Broken", Email: "bob", PhoneNumber: "+15550000002", Status: "active"},
+			{ID: "u3", Name: "Carol User", Email: "carol@example.com", PhoneNumber: "+15550000003", Status: "active"},
+			{ID: "u4", Name: "Ops Desk", Email: "it.ops@example.com", PhoneNumber: "+15550000004", Status: "active"},
+			{ID: "u5", Name: "Alice User", Email: "alice@example.com", PhoneNumber: "+15550000005", Status: "active"},
+			{ID: "u6", Name: "Dan Orphan", Email: "dan@example.com", PhoneNumber: "+15550009999", Status: "active"},
+		},
+		Numbers: []CanonicalNumber{
+			{ID: "n1", Number: "+15550000001", Capabilities: map[string]bool{"voice": true}},
+			{ID: "n2", Number: "+15550000002", Capabilities: map[string]bool{"voice": true}},
+			{ID: "n3", Number: "+15550000003", Capabilities: map[string]bool{"voice": true, "sms": true, "fax": true}},
+			{ID: "n4", Number: "+15550000004", Capabilities: map[string]bool{"voice": true}},
+			{ID: "n5", Number: "+15550000005", Capabilities: map[string]bool{"voice": true, "sms": true}},
+		},
+	}
+
+	plan := OfflinePlanner{}.PlanMigrationOrder(system)
+
+	// Admin first, then active by name, then accounts needing review, then inactive
+	if got, want := plannedIDs(plan), []string{"u4", "u5", "u3", "u2", "u6", "u1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+	risks := make(map[string]string)
+	for i, entry := range plan.RecommendedOrder {
+		if entry.Priority != i+1 {
+			t.Errorf("%s has priority %d at position %d", entry.Account.ID, entry.Priority, i+1)
+		}
+		risks[entry.Account.ID] = entry.Risk
+	}
+	if want := map[string]string{"u1": "low", "u2": "high", "u3": "medium", "u4": "low", "u5": "low", "u6": "high"}; !reflect.DeepEqual(risks, want) {
+		t.Errorf("risks = %v, want %v", risks, want)
+	}
+	if plan.GeneratedBy != planGeneratorOffline {
+		t.Errorf("GeneratedBy = %q", plan.GeneratedBy)
+	}
+	if len(plan.TodoList) == 0 || plan.EstimatedTime == "" {
+		t.Errorf("plan is missing its todo list or estimate: %+v", plan)
+	}
+}
+
+func TestOfflinePlannerIsDeterministic(t *testing.T) {
+	system := &CanonicalPhoneSystem{
+		Users: []CanonicalUser{
+			{ID: "b", Name: "Same Name", Email: "b@example.com", Status: "inactive"},
+			{ID: "a", Name: "Same Name", Email: "a@example.com", Status: "inactive"},
+			{ID: "c", Name: "Admin", Email: "admin@example.com", Status: "active"},
+		},
+	}
+	first := OfflinePlanner{}.PlanMigrationOrder(system)
+
+	// Ties on name fall back to ID, so input order does not matter
+	system.Users[0], system.Users[1] = system.Users[1], system.Users[0]
+	second := OfflinePlanner{}.PlanMigrationOrder(system)
+
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("plans differ:\n%+v\n%+v", first, second)
+	}
+}
+
+func TestLooksLikeAdmin(t *testing.T) {
+	for email, want := range map[string]bool{
+		"admin@example.com":    true,
+		"it-ops@example.com":   true,
+		"jane.noc@example.com": true,
+		"edith@example.com":    false,
+		"itsupport@example":    false,
+	} {
+		if got := looksLikeAdmin(email); got != want {
+			t.Errorf("looksLikeAdmin(%q) = %t, want %t", email, got, want)
+		}
+	}
+}
+
+func TestBuildMigrationPlanFromRingCentral(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "ringcentral.json")
+	if err := ioutil.WriteFile(source, []byte(`{
+		"accounts": [{"id": "1", "name": "Jane Smith", "contact": "jane@example.com", "main_number": "+15551230001", "active": true},
+			{"id": "2", "name": "Sam Lee", "contact": "sam@example.com", "main_number": "+15551230002", "active": false}],
+		"numbers": [{"id": "N1", "phone_number": "+15551230001", "features": ["voice"]}]
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The model answers with canonical accounts and leaves out Sam
+	plan := offlineTestPlan(t)
+	plan.RecommendedOrder = []AccountWithPriority{
+		{Account: CanonicalUser{ID: "1", Name: "J*** S***", Status: "active"}, Priority: 1, Reason: "Only active account", Risk: "low"},
+	}
+	plan.NumberPlan = []NumberWithPriority{{Number: CanonicalNumber{ID: "N1"}, Priority: 1, Reason: "Main line", Risk: "low"}}
+	response, _ := json.Marshal(plan)
+	fixtures, _ := json.Marshal([]string{string(response)})
+	fixtureFile := filepath.Join(dir, "fixtures.json")
+	if err := ioutil.WriteFile(fixtureFile, fixtures, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := MigrationConfig{
+		SourceFile:   source,
+		SourceFormat: "RingCentral",
+		TargetFormat: "Twilio",
+		UseAI:        true,
+		LLM:          LLMConfig{Provider: providerReplay, FixtureFile: fixtureFile, Redaction: "off"},
+	}
+	got, err := buildMigrationPlan(context.Background(), config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := plannedIDs(got); !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Errorf("order = %v, want the planned account then the missing one", ids)
+	}
+	if got.RecommendedOrder[0].Account.Email != "jane@example.com" {
+		t.Errorf("account was not restored from the source: %+v", got.RecommendedOrder[0].Account)
+	}
+	if number := got.NumberPlan[0]; number.Number.Number != "+15551230001" || len(number.CapabilitiesAtRisk) != 0 {
+		t.Errorf("number plan entry = %+v", number)
+	}
+	if got.GeneratedBy != planGeneratorEngineRoom {
+		t.Errorf("GeneratedBy = %q", got.GeneratedBy)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Number of times a malformed Engine Room AI plan is sent back for repair
+// before planning gives up
+const maxPlanRepairs = 2
+
+// Risk values accepted in AccountWithPriority.Risk and TodoItem.Risk
+var planRiskLevels = []string{"low", "medium", "high"}
+
+// PlanSchemaError lists everything wrong with a MigrationPlan returned by
+// Engine Room AI.
+type PlanSchemaError struct {
+	Problems []string
+}
+
+func (e *PlanSchemaError) Error() string {
+	return fmt.Sprintf("invalid migration plan: %s", strings.Join(e.Problems, "; "))
+}
+
+// requestPlan sends prompt and parses the reply as a MigrationPlan checked by
+// validate. Invalid plans are sent back with the problems found, a bounded
+// number of times.
+func (c *EngineRoomEnhancedMigrator) requestPlan(ctx context.Context, prompt string, validate func(*MigrationPlan) error) (*MigrationPlan, error) {
+	plan, _, err := c.requestPlanInConversation(ctx, []EngineRoomMessage{{Role: "user", Content: prompt}}, validate)
+	return plan, err
+}
+
+// requestPlanInConversation is requestPlan for a conversation that already
+// has earlier turns. It also returns the conversation including the reply
+// the plan was parsed from, so it can be continued.
+func (c *EngineRoomEnhancedMigrator) requestPlanInConversation(ctx context.Context, messages []EngineRoomMessage, validate func(*MigrationPlan) error) (*MigrationPlan, []EngineRoomMessage, error) {
+	for repairs := 0; ; repairs++ {
+		response, err := c.converse(ctx, messages)
+		if err != nil {
+			return nil, nil, fmt.Errorf("planning request failed: %w", err)
+		}
+		messages = append(messages, EngineRoomMessage{Role: "assistant", Content: response})
+
+		plan, err := parseMigrationPlan(response, validate)
+		if err == nil {
+			plan.Repairs = repairs
+			return plan, messages, nil
+		}
+		if repairs == maxPlanRepairs {
+			return nil, nil, fmt.Errorf("Engine Room AI plan still invalid after %d repair attempt(s): %w", repairs, err)
+		}
+
+		messages = append(messages, EngineRoomMessage{Role: "user", Content: planRepairPrompt(err)})
+	}
+}
+
+// parseMigrationPlan extracts the JSON object from an Engine Room AI response
+// and checks it with validate. Every failure is a *PlanSchemaError so it can
+// be sent back to the model.
+func parseMigrationPlan(response string, validate func(*MigrationPlan) error) (*MigrationPlan, error) {
+	jsonStart := strings.Index(response, "{")
+	jsonEnd := strings.LastIndex(response, "}") + 1
+	if jsonStart == -1 || jsonEnd <= jsonStart {
+		return nil, &PlanSchemaError{Problems: []string{"no JSON object found in the response"}}
+	}
+
+	var plan MigrationPlan
+	if err := json.Unmarshal([]byte(response[jsonStart:jsonEnd]), &plan); err != nil {
+		return nil, &PlanSchemaError{Problems: []string{fmt.Sprintf("response is not valid MigrationPlan JSON: %v", err)}}
+	}
+	if err := validate(&plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// validateMigrationPlan checks required fields, risk values, step numbering
+// and priority uniqueness.
+func validateMigrationPlan(plan *MigrationPlan) error {
+	problems := append(orderProblems(plan), summaryProblems(plan)...)
+	return schemaError(append(problems, numberPlanProblems(plan)...))
+}
+
+// validateNumberChunk checks the partial plan for one chunk of numbers,
+// which only has a number plan.
+func validateNumberChunk(plan *MigrationPlan) error {
+	return requireNumberPlan(func(plan *MigrationPlan) error {
+		return schemaError(numberPlanProblems(plan))
+	})(plan)
+}
+
+// requireNumberPlan extends validate to reject a plan without a number plan,
+// for sources that have phone numbers.
+func requireNumberPlan(validate func(*MigrationPlan) error) func(*MigrationPlan) error {
+	return func(plan *MigrationPlan) error {
+		var problems []string
+		var schemaErr *PlanSchemaError
+		if err := validate(plan); errors.As(err, &schemaErr) {
+			problems = schemaErr.Problems
+		} else if err != nil {
+			return err
+		}
+		if len(plan.NumberPlan) == 0 {
+			problems = append(problems, "number_plan is missing or empty")
+		}
+		return schemaError(problems)
+	}
+}
+
+// validatePlanChunk checks the partial plan for one chunk of users, which
+// only has a recommended order.
+func validatePlanChunk(plan *MigrationPlan) error {
+	return schemaError(orderProblems(plan))
+}
+
+// validatePlanSummary checks the consolidated plan of a chunked run, which
+// has everything but the recommended order.
+func validatePlanSummary(plan *MigrationPlan) error {
+	return schemaError(summaryProblems(plan))
+}
+
+func schemaError(problems []string) error {
+	if len(problems) > 0 {
+		return &PlanSchemaError{Problems: problems}
+	}
+	return nil
+}
+
+func orderProblems(plan *MigrationPlan) []string {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(plan.RecommendedOrder) == 0 {
+		addProblem("recommended_order is missing or empty")
+	}
+	priorities := make(map[int]string)
+	for i, item := range plan.RecommendedOrder {
+		where := fmt.Sprintf("recommended_order[%d]", i)
+		if item.Account.ID == "" {
+			addProblem("%s.account.id is missing", where)
+		}
+		if item.Priority < 1 {
+			addProblem("%s.priority must be a positive integer, got %d", where, item.Priority)
+		} else if other, ok := priorities[item.Priority]; ok {
+			addProblem("%s.priority %d is already used by %s", where, item.Priority, other)
+		} else {
+			priorities[item.Priority] = where
+		}
+		if strings.TrimSpace(item.Reason) == "" {
+			addProblem("%s.reason is missing or empty", where)
+		}
+		if !validRisk(item.Risk) {
+			addProblem("%s.risk_level must be one of %s, got %q", where, strings.Join(planRiskLevels, "/"), item.Risk)
+		}
+	}
+	return problems
+}
+
+func numberPlanProblems(plan *MigrationPlan) []string {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	priorities := make(map[int]string)
+	for i, item := range plan.NumberPlan {
+		where := fmt.Sprintf("number_plan[%d]", i)
+		if item.Number.ID == "" {
+			addProblem("%s.number.id is missing", where)
+		}
+		if item.Priority < 1 {
+			addProblem("%s.priority must be a positive integer, got %d", where, item.Priority)
+		} else if other, ok := priorities[item.Priority]; ok {
+			addProblem("%s.priority %d is already used by %s", where, item.Priority, other)
+		} else {
+			priorities[item.Priority] = where
+		}
+		if strings.TrimSpace(item.Reason) == "" {
+			addProblem("%s.reason is missing or empty", where)
+		}
+		if !validRisk(item.Risk) {
+			addProblem("%s.risk_level must be one of %s, got %q", where, strings.Join(planRiskLevels, "/"), item.Risk)
+		}
+	}
+	return problems
+}
+
+func summaryProblems(plan *MigrationPlan) []string {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	required := map[string]string{
+		"reasoning":       plan.Reasoning,
+		"risk_assessment": plan.RiskAssessment,
+		"estimated_time":  plan.EstimatedTime,
+	}
+	for _, field := range sortedKeys(required) {
+		if strings.TrimSpace(required[field]) == "" {
+			addProblem("%s is missing or empty", field)
+		}
+	}
+
+	if len(plan.TodoList) == 0 {
+		addProblem("todo_list is missing or empty")
+	}
+	for i, todo := range plan.TodoList {
+		where := fmt.Sprintf("todo_list[%d]", i)
+		if todo.Step != i+1 {
+			addProblem("%s.step must be %d (steps are numbered from 1 without gaps), got %d", where, i+1, todo.Step)
+		}
+		if strings.TrimSpace(todo.Description) == "" {
+			addProblem("%s.description is missing or empty", where)
+		}
+		if strings.TrimSpace(todo.Action) == "" {
+			addProblem("%s.action is missing or empty", where)
+		}
+		if !validRisk(todo.Risk) {
+			addProblem("%s.risk must be one of %s, got %q", where, strings.Join(planRiskLevels, "/"), todo.Risk)
+		}
+		if _, ok := stepExecutors[todo.Executor]; todo.Executor != "" && todo.Executor != executorManual && !ok {
+			addProblem("%s.executor %q is not a known executor", where, todo.Executor)
+		}
+	}
+	return problems
+}
+
+func validRisk(risk string) bool {
+	for _, level := range planRiskLevels {
+		if risk == level {
+			return true
+		}
+	}
+	return false
+}
+
+// planRepairPrompt asks the model to correct its previous plan.
+func planRepairPrompt(err error) string {
+	problems := []string{err.Error()}
+	var schemaErr *PlanSchemaError
+	if errors.As(err, &schemaErr) {
+		problems = schemaErr.Problems
+	}
+	return fmt.Sprintf(`Your migration plan could not be used because of these problems:
+- %s
+
+Respond with the corrected JSON object only, in the same format as requested before. Keep everything that was already valid.`, strings.Join(problems, "\n- "))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// scriptedProvider answers with each response in turn and keeps the
+// conversations it was sent.
+type scriptedProvider struct {
+	responses []string
+	sent      [][]EngineRoomMessage
+}
+
+func (p *scriptedProvider) Name() string { return "scripted" }
+
+func (p *scriptedProvider) Complete(ctx context.Context, messages []EngineRoomMessage) (*LLMResponse, error) {
+	p.sent = append(p.sent, messages)
+	if len(p.sent) > len(p.responses) {
+		return nil, errors.New("no scripted response left")
+	}
+	return &LLMResponse{Text: p.responses[len(p.sent)-1]}, nil
+}
+
+// testMigrator wraps provider the way NewEngineRoomEnhancedMigrator does.
+func testMigrator(provider LLMProvider) *EngineRoomEnhancedMigrator {
+	metered := &meteredProvider{inner: provider}
+	return &EngineRoomEnhancedMigrator{provider: metered, usage: metered, chunkSize: defaultPlanChunkSize}
+}
+
+func offlineTestPlan(t *testing.T) *MigrationPlan {
+	t.Helper()
+	return OfflinePlanner{}.PlanMigrationOrder(&CanonicalPhoneSystem{
+		Users: []CanonicalUser{
+			{ID: "AC1", Name: "John Doe", Email: "john@example.com", PhoneNumber: "+15551230001", Status: "active"},
+			{ID: "AC2", Name: "Jane Smith", Email: "jane@example.com", PhoneNumber: "+15551230002", Status: "inactive"},
+		},
+		Numbers: []CanonicalNumber{
+			{ID: "PN1", Number: "+15551230001", Capabilities: map[string]bool{"voice": true}},
+			{ID: "PN2", Number: "+15551230002", Capabilities: map[string]bool{"voice": true}},
+		},
+	})
+}
+
+func TestValidateMigrationPlan(t *testing.T) {
+	if err := validateMigrationPlan(offlineTestPlan(t)); err != nil {
+		t.Fatalf("offline plan is invalid: %v", err)
+	}
+
+	plan := offlineTestPlan(t)
+	plan.EstimatedTime = " "
+	plan.RecommendedOrder[1].Priority = plan.RecommendedOrder[0].Priority
+	plan.RecommendedOrder[1].Risk = "extreme"
+	plan.TodoList[2].Step = 7
+	plan.TodoList[3].Executor = "teleport"
+	plan.TodoList[4].Executor = executorManual
+
+	err := validateMigrationPlan(plan)
+	var schemaErr *PlanSchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("error = %v, want a *PlanSchemaError", err)
+	}
+	want := []string{
+		"recommended_order[1].priority 1 is already used by recommended_order[0]",
+		`recommended_order[1].risk_level must be one of low/medium/high, got "extreme"`,
+		"estimated_time is missing or empty",
+		"todo_list[2].step must be 3 (steps are numbered from 1 without gaps), got 7",
+		`todo_list[3].executor "teleport" is not a known executor`,
+	}
+	if strings.Join(schemaErr.Problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems:\n%s\nwant:\n%s", strings.Join(schemaErr.Problems, "\n"), strings.Join(want, "\n"))
+	}
+
+	if err := validateMigrationPlan(&MigrationPlan{}); err == nil || !strings.Contains(err.Error(), "todo_list is missing or empty") {
+		t.Errorf("empty plan error = %v", err)
+	}
+}
+
+func TestPlanMigrationOrderRepairsInvalidPlans(t *testing.T) {
+	valid, err := json.Marshal(offlineTestPlan(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &scriptedProvider{responses: []string{
+		"I could not produce a plan.",
+		`Here you go: {"reasoning": "first users first"}`,
+		"Corrected plan:\n" + string(valid),
+	}}
+	migrator := testMigrator(provider)
+
+	plan, err := migrator.PlanMigrationOrder(context.Background(), &CanonicalPhoneSystem{Users: []CanonicalUser{{ID: "AC1"}, {ID: "AC2"}}}, "RingCentral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Repairs != 2 || plan.GeneratedBy != planGeneratorEngineRoom {
+		t.Errorf("Repairs = %d, GeneratedBy = %q", plan.Repairs, plan.GeneratedBy)
+	}
+
+	// Each repair resends the whole conversation plus the problems found
+	last := provider.sent[2]
+	if len(last) != 5 || last[3].Content != `Here you go: {"reasoning": "first users first"}` {
+		t.Fatalf("repair conversation = %+v", last)
+	}
+	if !strings.Contains(last[4].Content, "- todo_list is missing or empty") {
+		t.Errorf("repair prompt does not list the problems:\n%s", last[4].Content)
+	}
+}
+
+func TestPlanMigrationOrderGivesUp(t *testing.T) {
+	provider := &scriptedProvider{responses: []string{"{}", "{}", "{}", "{}"}}
+	migrator := testMigrator(provider)
+
+	_, err := migrator.PlanMigrationOrder(context.Background(), &CanonicalPhoneSystem{Users: []CanonicalUser{{ID: "AC1"}}}, "RingCentral")
+	var schemaErr *PlanSchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("error = %v, want a wrapped *PlanSchemaError", err)
+	}
+	if len(provider.sent) != maxPlanRepairs+1 {
+		t.Errorf("sent %d requests, want %d", len(provider.sent), maxPlanRepairs+1)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Discrepancy kinds found when matching a plan against the source users
+const (
+	discrepancyUnknown   = "unknown_account"
+	discrepancyDuplicate = "duplicate_account"
+	discrepancyAltered   = "altered_account"
+	discrepancyMissing   = "missing_account"
+)
+
+// Discrepancy kinds found when matching a plan against the source numbers
+const (
+	discrepancyUnknownNumber   = "unknown_number"
+	discrepancyDuplicateNumber = "duplicate_number"
+	discrepancyAlteredNumber   = "altered_number"
+	discrepancyMissingNumber   = "missing_number"
+)
+
+type PlanDiscrepancy struct {
+	Kind      string `json:"kind"`
+	AccountID string `json:"account_id,omitempty"`
+	NumberID  string `json:"number_id,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+// Subject is the ID of the account or number the discrepancy is about.
+func (d PlanDiscrepancy) Subject() string {
+	if d.NumberID != "" {
+		return d.NumberID
+	}
+	return d.AccountID
+}
+
+// reconcilePlan matches every RecommendedOrder entry back to the source users
+// by account_sid. Unknown and duplicate IDs are dropped, altered records are
+// replaced by the source record and users the plan left out are appended at
+// the end. Users excluded from the plan are left out. Discrepancies are
+// recorded on the plan and the reconciled user order is returned. Running it
+// again on a reconciled plan is a no-op.
+func reconcilePlan(plan *MigrationPlan, users []CanonicalUser) []CanonicalUser {
+	sourceByID := make(map[string]CanonicalUser, len(users))
+	for _, user := range users {
+		sourceByID[user.ID] = user
+	}
+
+	var discrepancies []PlanDiscrepancy
+	var reconciled []AccountWithPriority
+	seen := make(map[string]bool)
+	for _, item := range plan.Excluded {
+		seen[item.Account.ID] = true
+	}
+	maxPriority := 0
+
+	for _, item := range plan.RecommendedOrder {
+		id := item.Account.ID
+		source, ok := sourceByID[id]
+		if !ok {
+			discrepancies = append(discrepancies, PlanDiscrepancy{
+				Kind:      discrepancyUnknown,
+				AccountID: id,
+				Detail:    fmt.Sprintf("%q is not in the source data and was removed from the plan", item.Account.Name),
+			})
+			continue
+		}
+		if seen[id] {
+			discrepancies = append(discrepancies, PlanDiscrepancy{
+				Kind:      discrepancyDuplicate,
+				AccountID: id,
+				Detail:    "listed more than once; only the first entry is kept",
+			})
+			continue
+		}
+		seen[id] = true
+
+		if changed := alteredUserFields(source, item.Account); len(changed) > 0 {
+			discrepancies = append(discrepancies, PlanDiscrepancy{
+				Kind:      discrepancyAltered,
+				AccountID: id,
+				Detail:    fmt.Sprintf("plan changed %s; the source record is used instead", strings.Join(changed, ", ")),
+			})
+		}
+
+		item.Account = source
+		if item.Priority > maxPriority {
+			maxPriority = item.Priority
+		}
+		reconciled = append(reconciled, item)
+	}
+
+	for _, user := range users {
+		if seen[user.ID] {
+			continue
+		}
+		seen[user.ID] = true
+		maxPriority++
+		discrepancies = append(discrepancies, PlanDiscrepancy{
+			Kind:      discrepancyMissing,
+			AccountID: user.ID,
+			Detail:    fmt.Sprintf("%q was missing from the plan and was appended at the end", user.Name),
+		})
+		reconciled = append(reconciled, AccountWithPriority{
+			Account:  user,
+			Priority: maxPriority,
+			Reason:   "Not included in the recommended order - appended during reconciliation",
+			Risk:     "medium",
+		})
+	}
+
+	plan.RecommendedOrder = reconciled
+	plan.Reconciliation = append(plan.Reconciliation, discrepancies...)
+
+	ordered := make([]CanonicalUser, len(reconciled))
+	for i, item := range reconciled {
+		ordered[i] = item.Account
+	}
+	return ordered
+}
+
+func alteredUserFields(source, planned CanonicalUser) []string {
+	var changed []string
+	if source.Name != planned.Name {
+		changed = append(changed, "name")
+	}
+	if source.Email != planned.Email {
+		changed = append(changed, "email")
+	}
+	if source.PhoneNumber != planned.PhoneNumber {
+		changed = append(changed, "phone_number")
+	}
+	if source.Status != planned.Status {
+		changed = append(changed, "status")
+	}
+	return changed
+}
+
+// reconcileNumberPlan does for NumberPlan what reconcilePlan does for the
+// recommended order, matching entries to the source numbers by ID. The
+// capabilities at risk are recomputed from the capability mapping for the
+// target format rather than trusted from the plan. The reconciled porting
+// order is returned.
+func reconcileNumberPlan(plan *MigrationPlan, numbers []CanonicalNumber, targetFormat string) []CanonicalNumber {
+	if len(plan.NumberPlan) == 0 && len(numbers) == 0 {
+		return numbers
+	}
+
+	sourceByID := make(map[string]CanonicalNumber, len(numbers))
+	for _, number := range numbers {
+		sourceByID[number.ID] = number
+	}
+
+	var discrepancies []PlanDiscrepancy
+	var reconciled []NumberWithPriority
+	seen := make(map[string]bool)
+	maxPriority := 0
+
+	for _, item := range plan.NumberPlan {
+		id := item.Number.ID
+		source, ok := sourceByID[id]
+		if !ok {
+			discrepancies = append(discrepancies, PlanDiscrepancy{
+				Kind:     discrepancyUnknownNumber,
+				NumberID: id,
+				Detail:   fmt.Sprintf("%s is not in the source data and was removed from the plan", item.Number.Number),
+			})
+			continue
+		}
+		if seen[id] {
+			discrepancies = append(discrepancies, PlanDiscrepancy{
+				Kind:     discrepancyDuplicateNumber,
+				NumberID: id,
+				Detail:   "listed more than once; only the first entry is kept",
+			})
+			continue
+		}
+		seen[id] = true
+
+		if changed := alteredNumberFields(source, item.Number); len(changed) > 0 {
+			discrepancies = append(discrepancies, PlanDiscrepancy{
+				Kind:     discrepancyAlteredNumber,
+				NumberID: id,
+				Detail:   fmt.Sprintf("plan changed %s; the source record is used instead", strings.Join(changed, ", ")),
+			})
+		}
+
+		item.Number = source
+		item.CapabilitiesAtRisk = capabilitiesAtRisk(source, targetFormat)
+		if item.Priority > maxPriority {
+			maxPriority = item.Priority
+		}
+		reconciled = append(reconciled, item)
+	}
+
+	for _, number := range numbers {
+		if seen[number.ID] {
+			continue
+		}
+		seen[number.ID] = true
+		maxPriority++
+		discrepancies = append(discrepancies, PlanDiscrepancy{
+			Kind:     discrepancyMissingNumber,
+			NumberID: number.ID,
+			Detail:   fmt.Sprintf("%s was missing from the plan and was appended at the end", number.Number),
+		})
+		reconciled = append(reconciled, NumberWithPriority{
+			Number:             number,
+			Priority:           maxPriority,
+			Reason:             "Not included in the number plan - appended during reconciliation",
+			Risk:               "medium",
+			CapabilitiesAtRisk: capabilitiesAtRisk(number, targetFormat),
+		})
+	}
+
+	plan.NumberPlan = reconciled
+	plan.Reconciliation = append(plan.Reconciliation, discrepancies...)
+
+	ordered := make([]CanonicalNumber, len(reconciled))
+	for i, item := range reconciled {
+		ordered[i] = item.Number
+	}
+	return ordered
+}
+
+func alteredNumberFields(source, planned CanonicalNumber) []string {
+	var changed []string
+	if source.Number != planned.Number {
+		changed = append(changed, "phone_number")
+	}
+	if source.Location != planned.Location {
+		changed = append(changed, "location")
+	}
+	if planned.Capabilities != nil && strings.Join(enabledCapabilities(source), ",") != strings.Join(enabledCapabilities(planned), ",") {
+		changed = append(changed, "capabilities")
+	}
+	return changed
+}
+
+// capabilitiesAtRisk lists the number's enabled capabilities that the target
+// format cannot express.
+func capabilitiesAtRisk(number CanonicalNumber, targetFormat string) []string {
+	var atRisk []string
+	for _, capability := range enabledCapabilities(number) {
+		if _, ok := platformCapability(targetFormat, capability); !ok {
+			atRisk = append(atRisk, capability)
+		}
+	}
+	return atRisk
+}
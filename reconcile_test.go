@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReconcilePlan(t *testing.T) {
+	users := []CanonicalUser{
+		{ID: "AC1", Name: "John Doe", Email: "john@example.com", PhoneNumber: "+15551230001", Status: "active"},
+		{ID: "AC2", Name: "Jane Smith", Email: "jane@example.com", PhoneNumber: "+15551230002", Status: "active"},
+		{ID: "AC3", Name: "Mike Johnson", Email: "mike@example.com", PhoneNumber: "+15551230003", Status: "inactive"},
+	}
+	altered := users[1]
+	altered.Email = "jane@attacker.example"
+	plan := &MigrationPlan{RecommendedOrder: []AccountWithPriority{
+		{Account: CanonicalUser{ID: "AC9", Name: "Ghost"}, Priority: 1},
+		{Account: altered, Priority: 2, Reason: "keep me"},
+		{Account: users[0], Priority: 3},
+		{Account: users[1], Priority: 4},
+	}}
+
+	ordered := reconcilePlan(plan, users)
+
+	if want := []CanonicalUser{users[1], users[0], users[2]}; !reflect.DeepEqual(ordered, want) {
+		t.Errorf("ordered = %+v, want %+v", ordered, want)
+	}
+	var kinds []string
+	for _, d := range plan.Reconciliation {
+		kinds = append(kinds, d.Kind+":"+d.AccountID)
+	}
+	wantKinds := []string{
+		discrepancyUnknown + ":AC9",
+		discrepancyAltered + ":AC2",
+		discrepancyDuplicate + ":AC2",
+		discrepancyMissing + ":AC3",
+	}
+	if !reflect.DeepEqual(kinds, wantKinds) {
+		t.Errorf("discrepancies = %v, want %v", kinds, wantKinds)
+	}
+	if plan.RecommendedOrder[0].Reason != "keep me" {
+		t.Errorf("reason of a corrected entry was lost: %q", plan.RecommendedOrder[0].Reason)
+	}
+	if last := plan.RecommendedOrder[2]; last.Priority != 4 {
+		t.Errorf("appended account has priority %d, want 4", last.Priority)
+	}
+
+	// A reconciled plan matches the source, so a second run changes nothing
+	before := *plan
+	before.RecommendedOrder = append([]AccountWithPriority(nil), plan.RecommendedOrder...)
+	again := reconcilePlan(plan, users)
+	if !reflect.DeepEqual(again, ordered) || !reflect.DeepEqual(plan.RecommendedOrder, before.RecommendedOrder) {
+		t.Error("second reconciliation changed the order")
+	}
+	if len(plan.Reconciliation) != len(wantKinds) {
+		t.Errorf("second reconciliation added discrepancies: %+v", plan.Reconciliation[len(wantKinds):])
+	}
+}
+
+func TestReconcileNumberPlan(t *testing.T) {
+	numbers := []CanonicalNumber{
+		{ID: "PN1", Number: "+15551230001", Capabilities: map[string]bool{"voice": true, "fax": true}},
+		{ID: "PN2", Number: "+15551230002", Capabilities: map[string]bool{"voice": true, "voicemail": true}},
+		{ID: "PN3", Number: "+15551230003", Capabilities: map[string]bool{"sms": true}},
+	}
+	moved := numbers[1]
+	moved.Location = "US-West"
+	moved.Capabilities = map[string]bool{"voice": true}
+	plan := &MigrationPlan{NumberPlan: []NumberWithPriority{
+		{Number: moved, Priority: 1, CapabilitiesAtRisk: []string{"sms"}},
+		{Number: CanonicalNumber{ID: "PN9", Number: "+15559999999"}, Priority: 2},
+		{Number: CanonicalNumber{ID: "PN1"}, Priority: 3},
+		{Number: CanonicalNumber{ID: "PN2"}, Priority: 4},
+	}}
+
+	ordered := reconcileNumberPlan(plan, numbers, "Twilio")
+
+	var ids []string
+	for _, number := range ordered {
+		ids = append(ids, number.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"PN2", "PN1", "PN3"}) {
+		t.Errorf("porting order = %v", ids)
+	}
+	if !reflect.DeepEqual(ordered[0], numbers[1]) {
+		t.Errorf("altered number was not replaced by the source: %+v", ordered[0])
+	}
+
+	// Capabilities at risk come from the mapping, not from the plan
+	atRisk := make(map[string][]string)
+	for _, item := range plan.NumberPlan {
+		atRisk[item.Number.ID] = item.CapabilitiesAtRisk
+	}
+	if want := map[string][]string{"PN1": nil, "PN2": {"voicemail"}, "PN3": nil}; !reflect.DeepEqual(atRisk, want) {
+		t.Errorf("capabilities at risk = %v, want %v", atRisk, want)
+	}
+
+	var found []string
+	for _, d := range plan.Reconciliation {
+		found = append(found, d.Kind+":"+d.NumberID+":"+d.Detail)
+	}
+	want := []string{
+		discrepancyAlteredNumber + ":PN2:plan changed location, capabilities; the source record is used instead",
+		discrepancyUnknownNumber + ":PN9:+15559999999 is not in the source data and was removed from the plan",
+		discrepancyAlteredNumber + ":PN1:plan changed phone_number; the source record is used instead",
+		discrepancyDuplicateNumber + ":PN2:listed more than once; only the first entry is kept",
+		discrepancyMissingNumber + ":PN3:+15551230003 was missing from the plan and was appended at the end",
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("discrepancies:\n%s\nwant:\n%s", strings.Join(found, "\n"), strings.Join(want, "\n"))
+	}
+
+	again := reconcileNumberPlan(plan, numbers, "Twilio")
+	if !reflect.DeepEqual(again, ordered) || len(plan.Reconciliation) != len(want) {
+		t.Errorf("second reconciliation was not a no-op: %+v", plan.Reconciliation[len(want):])
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Default exchange log, appended to for every Engine Room AI call
+const defaultRecordFile = "engine-room-calls.jsonl"
+
+// One Engine Room AI request/response pair, stored as a line of JSONL
+type EngineRoomExchange struct {
+	Timestamp  time.Time           `json:"timestamp"`
+	Provider   string              `json:"provider"`
+	Model      string              `json:"model"`
+	PromptHash string              `json:"prompt_hash"`
+	Prompt     []EngineRoomMessage `json:"prompt"`
+	Response   string              `json:"response,omitempty"`
+	Usage      EngineRoomUsage     `json:"usage"`
+	LatencyMS  int64               `json:"latency_ms"`
+	Status     string              `json:"status"` // "ok" or "error"
+	Error      string              `json:"error,omitempty"`
+
+	RedactionKeyID string `json:"redaction_key_id,omitempty"` // key of the prompt's hash tokens, see redactionKeyID
+}
+
+// promptHash identifies a conversation independently of when it was sent.
+func promptHash(messages []EngineRoomMessage) string {
+	data, _ := json.Marshal(messages)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordingProvider appends every exchange with the wrapped provider to a
+// JSONL file. A failure to record is logged; the response is still returned.
+type recordingProvider struct {
+	inner LLMProvider
+	model string
+	keyID string
+	path  string
+	mu    sync.Mutex
+}
+
+func (p *recordingProvider) Name() string { return p.inner.Name() }
+
+func (p *recordingProvider) Complete(ctx context.Context, messages []EngineRoomMessage) (*LLMResponse, error) {
+	start := time.Now()
+	response, err := p.inner.Complete(ctx, messages)
+
+	exchange := EngineRoomExchange{
+		Timestamp:  start,
+		Provider:   p.inner.Name(),
+		Model:      p.model,
+		PromptHash: promptHash(messages),
+		Prompt:     messages,
+		LatencyMS:  time.Since(start).Milliseconds(),
+		Status:     "ok",
+
+		RedactionKeyID: p.keyID,
+	}
+	if err != nil {
+		exchange.Status = "error"
+		exchange.Error = err.Error()
+	} else {
+		exchange.Response = response.Text
+		exchange.Usage = response.Usage
+		if response.Model != "" {
+			exchange.Model = response.Model
+		}
+	}
+
+	if recordErr := p.append(exchange); recordErr != nil {
+		log.Printf("Engine Room AI exchange not recorded: %v", recordErr)
+	}
+	return response, err
+}
+
+func (p *recordingProvider) append(exchange EngineRoomExchange) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	line, err := json.Marshal(exchange)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(p.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open exchange log: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write exchange log: %w", err)
+	}
+	return nil
+}
+
+// loadExchangeLog reads a JSONL exchange log and indexes the successful
+// responses by prompt hash. Later entries win.
+func loadExchangeLog(path string) (map[string]EngineRoomExchange, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange log: %w", err)
+	}
+	defer file.Close()
+
+	exchanges := make(map[string]EngineRoomExchange)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var exchange EngineRoomExchange
+		if err := json.Unmarshal(scanner.Bytes(), &exchange); err != nil {
+			return nil, fmt.Errorf("failed to parse exchange log line %d: %w", line, err)
+		}
+		if exchange.Status == "ok" && exchange.PromptHash != "" {
+			exchanges[exchange.PromptHash] = exchange
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read exchange log: %w", err)
+	}
+	return exchanges, nil
+}
+
+// checkReplayKey makes sure hashed fields come out as they were recorded,
+// since otherwise no prompt hash in the log would match. Exchanges recorded
+// with a random per-run key cannot be replayed.
+func checkReplayKey(policy RedactionPolicy, exchanges map[string]EngineRoomExchange) error {
+	if !policy.hashes() {
+		return nil
+	}
+	if os.Getenv(redactionKeyEnv) == "" {
+		return fmt.Errorf("replaying an exchange log with hashed fields needs %s set to the key it was recorded with", redactionKeyEnv)
+	}
+	keyID, err := redactionKeyID(policy)
+	if err != nil {
+		return err
+	}
+	for _, exchange := range exchanges {
+		if exchange.RedactionKeyID != "" && exchange.RedactionKeyID != keyID {
+			return fmt.Errorf("the exchange log was recorded with redaction key %s, but %s is key %s",
+				exchange.RedactionKeyID, redactionKeyEnv, keyID)
+		}
+	}
+	return nil
+}
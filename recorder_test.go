@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Setenv(redactionKeyEnv, "test key")
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 2 {
+			http.Error(w, "prompt too long", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"content": [{"type": "text", "text": "recorded answer"}], "usage": {"input_tokens": 7, "output_tokens": 2}}`))
+	}))
+	defer server.Close()
+
+	log := filepath.Join(t.TempDir(), "calls.jsonl")
+	live, err := newLLMProvider(LLMConfig{Provider: providerAnthropic, APIKey: "key", BaseURL: server.URL, RecordFile: log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	question := []EngineRoomMessage{{Role: "user", Content: "plan this"}}
+	if _, err := live.Complete(context.Background(), question); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := live.Complete(context.Background(), []EngineRoomMessage{{Role: "user", Content: "and this"}}); err == nil {
+		t.Fatal("server error was not returned")
+	}
+
+	data, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `"status":"error"`) {
+		t.Fatalf("exchange log = %s", data)
+	}
+	// A failed call has no response to name the model, so the one asked for is recorded
+	if model := `"model":"` + defaultLLMModels[providerAnthropic] + `"`; !strings.Contains(string(data), model) {
+		t.Errorf("exchange log does not record %s: %s", model, data)
+	}
+
+	// Only the successful exchange can be replayed
+	replay, err := newLLMProvider(LLMConfig{Provider: providerReplay, FixtureFile: log, RecordFile: filepath.Join(t.TempDir(), "unused.jsonl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := replay.Complete(context.Background(), question)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "recorded answer" || resp.Usage.InputTokens != 7 {
+		t.Errorf("replayed response = %+v", resp)
+	}
+	if _, err := replay.Complete(context.Background(), []EngineRoomMessage{{Role: "user", Content: "and this"}}); err == nil {
+		t.Error("replayed a failed exchange")
+	}
+	if calls != 2 {
+		t.Errorf("replay reached the server: %d calls", calls)
+	}
+}
+
+func TestLoadExchangeLogRejectsCorruptLines(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "calls.jsonl")
+	if err := ioutil.WriteFile(log, []byte("{\"status\":\"ok\",\"prompt_hash\":\"a\"}\n\n{not json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadExchangeLog(log); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("error = %v, want one naming line 3", err)
+	}
+}
+
+func TestRecordingFailureKeepsResponse(t *testing.T) {
+	provider := &recordingProvider{
+		inner: &scriptedProvider{responses: []string{"the plan"}},
+		path:  filepath.Join(t.TempDir(), "missing", "calls.jsonl"),
+	}
+	resp, err := provider.Complete(context.Background(), []EngineRoomMessage{{Role: "user", Content: "plan this"}})
+	if err != nil {
+		t.Fatalf("a log that cannot be written failed the call: %v", err)
+	}
+	if resp.Text != "the plan" {
+		t.Errorf("response = %+v", resp)
+	}
+}
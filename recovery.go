@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// What was running when the migration failed, which decides what a retry
+// repeats
+type failureStage int
+
+const (
+	planFailed      failureStage = iota + 1 // generating the plan
+	stepFailed                              // running a step of the plan
+	migrationFailed                         // the standard migration without a plan
+)
+
+// Choices on the recovery screen
+const (
+	recoverRetry = iota
+	recoverEditConfig
+	recoverWithoutAI
+	recoverQuit
+)
+
+type recoveryOption struct {
+	action int
+	label  string
+}
+
+// fail shows the recovery screen for err.
+func (m model) fail(stage failureStage, err error) model {
+	m.err = err
+	m.failedStage = stage
+	m.selectedRecovery = 0
+	m.state = recovering
+	return m
+}
+
+// recoveryOptions offers to continue without Engine Room AI only when it was
+// in use.
+func (m model) recoveryOptions() []recoveryOption {
+	retry := "Retry - generate the plan again"
+	switch m.failedStage {
+	case stepFailed:
+		retry = "Retry - run the plan again from the start"
+	case migrationFailed:
+		retry = "Retry - run the migration again"
+	}
+
+	options := []recoveryOption{
+		{recoverRetry, retry},
+		{recoverEditConfig, "Edit configuration - change files or formats"},
+	}
+	if m.config.UseAI {
+		options = append(options, recoveryOption{recoverWithoutAI, "Continue without AI - plan with the offline planner"})
+	}
+	return append(options, recoveryOption{recoverQuit, "Quit"})
+}
+
+func (m model) updateRecovery(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	options := m.recoveryOptions()
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m.quit()
+	case "up", "k":
+		if m.selectedRecovery > 0 {
+			m.selectedRecovery--
+		}
+	case "down", "j":
+		if m.selectedRecovery < len(options)-1 {
+			m.selectedRecovery++
+		}
+	case "enter", " ":
+		return m.recover(options[m.selectedRecovery].action)
+	}
+	return m, nil
+}
+
+func (m model) recover(action int) (tea.Model, tea.Cmd) {
+	switch action {
+	case recoverRetry:
+		m.err = nil
+		switch m.failedStage {
+		case planFailed:
+			return m.startPlanning()
+		case stepFailed:
+			m.rolledBack = nil
+			m.state = executingPlan
+			m.currentStep = 0
+			m.run = newMigrationRun(m.config, m.migrationPlan)
+			m = m.initializeExecutionSteps()
+			var cmd tea.Cmd
+			m, cmd = m.startCurrentStep()
+			return m, tea.Batch(m.spinner.Tick, cmd)
+		}
+		return m.startStandardMigration()
+
+	case recoverEditConfig:
+		m = m.resetRun()
+		m.state = enteringSource
+		// Read the directory again, it may have changed (or never been read when resuming)
+		return m, m.filepicker.Init()
+
+	case recoverWithoutAI:
+		m = m.resetRun()
+		m.config.UseAI = false
+		m.config.OfflinePlan = true
+		m.selectedAI = 1
+		return m.startPlanning()
+	}
+	return m.quit()
+}
+
+// resetRun drops the plan and everything that came of it, keeping the
+// configuration.
+func (m model) resetRun() model {
+	m.err = nil
+	m.failedStage = 0
+	m.migrationPlan = nil
+	m.originalPlan = nil
+	m.planProgress = nil
+	m.refinement = nil
+	m.chatting = false
+	m.chatPending = false
+	m.chatLog = nil
+	m.lastChanges = nil
+	m.executionSteps = nil
+	m.run = nil
+	m.currentStep = 0
+	m.userApproved = false
+	m.skipping = false
+	m.rolledBack = nil
+	return m
+}
+
+func (m model) recoveryView() string {
+	var s strings.Builder
+
+	s.WriteString(errorStyle.Render("❌ Something went wrong"))
+	s.WriteString("\n\n")
+	if m.failedStage == stepFailed && m.currentStep < len(m.executionSteps) {
+		step := m.executionSteps[m.currentStep]
+		s.WriteString(fmt.Sprintf("Step %d failed: %s\n", step.StepNumber, step.Description))
+	}
+	s.WriteString(fmt.Sprintf("Error: %v\n\n", m.err))
+	if len(m.rolledBack) > 0 {
+		s.WriteString(subtitleStyle.Render("↩️  Rolled back:"))
+		s.WriteString("\n")
+		for _, line := range m.rolledBack {
+			s.WriteString(fmt.Sprintf("• %s\n", line))
+		}
+		s.WriteString("\n")
+	}
+	s.WriteString(fmt.Sprintf("Source: %s (%s)\n", m.config.SourceFile, m.config.SourceFormat))
+	s.WriteString(fmt.Sprintf("Target: %s (%s)\n\n", m.config.TargetFile, m.config.TargetFormat))
+
+	s.WriteString(subtitleStyle.Render("How do you want to continue?"))
+	s.WriteString("\n\n")
+	for i, option := range m.recoveryOptions() {
+		cursor := " "
+		if i == m.selectedRecovery {
+			cursor = ">"
+		}
+		s.WriteString(fmt.Sprintf("%s %s\n", cursor, option.label))
+	}
+	s.WriteString("\n")
+	s.WriteString(helpStyle.Render("Navigate with ↑/↓, select with Enter, quit with q"))
+	return s.String()
+}
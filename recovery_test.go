@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestEscWalksBackThroughWizard(t *testing.T) {
+	m := initialModel()
+	m.config.TargetFile = "out.json"
+	m.state = askingAIPreference
+
+	for _, want := range []state{selectingTargetFormat, enteringTarget, selectingSourceFormat, previewingSource} {
+		m = sendKey(t, m, tea.KeyEsc)
+		if m.state != want {
+			t.Fatalf("Esc went to state %v, want %v", m.state, want)
+		}
+		if want == enteringTarget && m.textInput.Value() != "out.json" {
+			t.Errorf("target filename %q was not kept", m.textInput.Value())
+		}
+	}
+}
+
+func TestRecoverFromPlanFailure(t *testing.T) {
+	m := initialModel()
+	m.config.UseAI = true
+	m.state = showingPlan
+
+	updated, _ := m.Update(migrationPlanMsg{err: errors.New("engine room unavailable")})
+	m = updated.(model)
+	if m.state != recovering || m.failedStage != planFailed {
+		t.Fatalf("state %v, failed stage %v", m.state, m.failedStage)
+	}
+	options := m.recoveryOptions()
+	if len(options) != 4 || options[2].action != recoverWithoutAI {
+		t.Fatalf("recovery options = %+v", options)
+	}
+
+	m = sendKey(t, m, tea.KeyDown)
+	m = sendKey(t, m, tea.KeyDown)
+	m = sendKey(t, m, tea.KeyEnter)
+	if m.state != showingPlan || m.config.UseAI || !m.config.OfflinePlan || m.err != nil {
+		t.Errorf("continue without AI: state %v, UseAI %t, OfflinePlan %t, err %v",
+			m.state, m.config.UseAI, m.config.OfflinePlan, m.err)
+	}
+}
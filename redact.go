@@ -0,0 +1,409 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redaction modes for a CanonicalUser field
+const (
+	redactNone = "none" // sent as-is
+	redactHash = "hash" // replaced by a keyed hash token
+	redactMask = "mask" // partly hidden, keeping the shape of the value
+)
+
+// Fields that can be redacted, by their JSON name
+var redactableFields = []string{"id", "name", "email", "phone_number"}
+
+// Twilio field names accepted in policies written before plans used
+// CanonicalUser
+var redactionFieldAliases = map[string]string{
+	"account_sid":   "id",
+	"friendly_name": "name",
+}
+
+// RedactionPolicy maps a CanonicalUser JSON field name to its redaction mode.
+// Fields not listed are sent as-is.
+type RedactionPolicy map[string]string
+
+var defaultRedactionPolicy = RedactionPolicy{
+	"name":         redactHash,
+	"email":        redactMask,
+	"phone_number": redactMask,
+}
+
+// Environment variables for the redaction policy and the hash key
+const (
+	redactionPolicyEnv = "ENGINE_ROOM_REDACTION"
+	redactionKeyEnv    = "ENGINE_ROOM_REDACTION_KEY"
+)
+
+// parseRedactionPolicy reads a policy such as
+// "name=hash,email=mask". "off" disables redaction and an empty
+// string selects the default policy.
+func parseRedactionPolicy(spec string) (RedactionPolicy, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return defaultRedactionPolicy, nil
+	}
+	if spec == "off" {
+		return RedactionPolicy{}, nil
+	}
+
+	policy := RedactionPolicy{}
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid redaction entry %q, expected field=mode", entry)
+		}
+		field, mode := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if alias, ok := redactionFieldAliases[field]; ok {
+			field = alias
+		}
+		if !containsString(redactableFields, field) {
+			return nil, fmt.Errorf("unknown redaction field %q (fields: %s)", field, strings.Join(redactableFields, ", "))
+		}
+		if mode != redactNone && mode != redactHash && mode != redactMask {
+			return nil, fmt.Errorf("unknown redaction mode %q for %s (modes: none, hash, mask)", mode, field)
+		}
+		if mode != redactNone {
+			policy[field] = mode
+		}
+	}
+	return policy, nil
+}
+
+// Describe lists the mode of every redactable field, for migration metadata.
+func (p RedactionPolicy) Describe() map[string]string {
+	described := make(map[string]string, len(redactableFields))
+	for _, field := range redactableFields {
+		described[field] = redactNone
+		if mode, ok := p[field]; ok {
+			described[field] = mode
+		}
+	}
+	return described
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// hashes reports whether any field is replaced by a keyed hash token.
+func (p RedactionPolicy) hashes() bool {
+	for _, mode := range p {
+		if mode == redactHash {
+			return true
+		}
+	}
+	return false
+}
+
+// Redactor pseudonymizes user fields for one conversation with Engine Room
+// AI and keeps the token table needed to restore the originals. Tokens are
+// deterministic within a run, and across runs when ENGINE_ROOM_REDACTION_KEY
+// is set, so the same data produces the same prompt.
+type Redactor struct {
+	policy    RedactionPolicy
+	key       []byte
+	originals map[string]string // token -> original value
+	tokens    map[string]string // field + original value -> token
+}
+
+func newRedactor(policy RedactionPolicy) (*Redactor, error) {
+	key, err := redactionKey()
+	if err != nil {
+		return nil, err
+	}
+	return &Redactor{
+		policy:    policy,
+		key:       key,
+		originals: make(map[string]string),
+		tokens:    make(map[string]string),
+	}, nil
+}
+
+// KeyID identifies the key of the redactor's hash tokens, see redactionKeyID.
+func (r *Redactor) KeyID() string {
+	if !r.policy.hashes() {
+		return ""
+	}
+	return keyFingerprint(r.key)
+}
+
+// Hash key of a run without ENGINE_ROOM_REDACTION_KEY
+var (
+	runRedactionKey     []byte
+	runRedactionKeyErr  error
+	runRedactionKeyOnce sync.Once
+)
+
+// redactionKey is the configured hash key or, when none is set, a random key
+// made once per run. An empty key would let anyone reverse hash tokens by
+// hashing likely names and emails.
+func redactionKey() ([]byte, error) {
+	if key := os.Getenv(redactionKeyEnv); key != "" {
+		return []byte(key), nil
+	}
+	runRedactionKeyOnce.Do(func() {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			runRedactionKeyErr = fmt.Errorf("failed to generate a redaction key: %w", err)
+			return
+		}
+		runRedactionKey = key
+	})
+	return runRedactionKey, runRedactionKeyErr
+}
+
+// redactionKeyID identifies the key the policy's hash tokens are made with,
+// without revealing it, so an exchange log or output can be matched to its
+// key. It is empty when the policy hashes nothing.
+func redactionKeyID(policy RedactionPolicy) (string, error) {
+	if !policy.hashes() {
+		return "", nil
+	}
+	key, err := redactionKey()
+	if err != nil {
+		return "", err
+	}
+	return keyFingerprint(key), nil
+}
+
+func keyFingerprint(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("redaction key id"))
+	return hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// RedactUsers returns copies of users with the policy's fields replaced by
+// tokens.
+func (r *Redactor) RedactUsers(users []CanonicalUser) []CanonicalUser {
+	redacted := make([]CanonicalUser, len(users))
+	for i, user := range users {
+		user.ID = r.token("id", user.ID)
+		user.Name = r.token("name", user.Name)
+		user.Email = r.token("email", user.Email)
+		user.PhoneNumber = r.token("phone_number", user.PhoneNumber)
+		redacted[i] = user
+	}
+	return redacted
+}
+
+// RedactNumbers returns copies of numbers with the phone number replaced as
+// the policy's phone_number mode says, using the same tokens as for users.
+func (r *Redactor) RedactNumbers(numbers []CanonicalNumber) []CanonicalNumber {
+	redacted := make([]CanonicalNumber, len(numbers))
+	for i, number := range numbers {
+		number.Number = r.token("phone_number", number.Number)
+		redacted[i] = number
+	}
+	return redacted
+}
+
+func (r *Redactor) token(field, value string) string {
+	mode := r.policy[field]
+	if value == "" || mode == "" || mode == redactNone {
+		return value
+	}
+	if token, ok := r.tokens[field+"\x00"+value]; ok {
+		return token
+	}
+
+	var token string
+	switch mode {
+	case redactHash:
+		mac := hmac.New(sha256.New, r.key)
+		mac.Write([]byte(field + "\x00" + value))
+		token = fmt.Sprintf("%s_%s", strings.ToUpper(field), hex.EncodeToString(mac.Sum(nil))[:10])
+	case redactMask:
+		token = maskValue(field, value)
+		// Two values can share a mask, so later ones get a suffix to keep
+		// every token reversible
+		base := token
+		for n := 2; r.originals[token] != ""; n++ {
+			if at := strings.LastIndex(base, "@"); at >= 0 {
+				token = fmt.Sprintf("%s%d%s", base[:at], n, base[at:])
+			} else {
+				token = fmt.Sprintf("%s#%d", base, n)
+			}
+		}
+	}
+
+	r.originals[token] = value
+	r.tokens[field+"\x00"+value] = token
+	return token
+}
+
+// maskValue hides most of a value but keeps what the model needs to judge
+// it: the email domain, the length and country prefix of a phone number and
+// the initials of a name.
+func maskValue(field, value string) string {
+	switch field {
+	case "email":
+		at := strings.LastIndex(value, "@")
+		if at <= 0 {
+			return "***"
+		}
+		return firstRune(value) + "***" + value[at:]
+	case "phone_number":
+		if len(value) <= 6 {
+			return strings.Repeat("*", len(value))
+		}
+		return value[:3] + strings.Repeat("*", len(value)-5) + value[len(value)-2:]
+	case "name":
+		var initials []string
+		for _, word := range strings.Fields(value) {
+			initials = append(initials, firstRune(word)+"***")
+		}
+		return strings.Join(initials, " ")
+	}
+	if len(value) <= 6 {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:2] + "***" + value[len(value)-4:]
+}
+
+func firstRune(s string) string {
+	for _, r := range s {
+		return string(r)
+	}
+	return ""
+}
+
+// RestoreUser replaces the tokens in a user returned by the model with the
+// original values. Values that are not tokens are left alone.
+func (r *Redactor) RestoreUser(user CanonicalUser) CanonicalUser {
+	user.ID = r.restoreValue(user.ID)
+	user.Name = r.restoreValue(user.Name)
+	user.Email = r.restoreValue(user.Email)
+	user.PhoneNumber = r.restoreValue(user.PhoneNumber)
+	return user
+}
+
+func (r *Redactor) restoreValue(value string) string {
+	if original, ok := r.originals[value]; ok {
+		return original
+	}
+	return value
+}
+
+// RestoreText replaces every token in free text, longest tokens first so a
+// token is never replaced inside a longer one.
+func (r *Redactor) RestoreText(text string) string {
+	if len(r.originals) == 0 {
+		return text
+	}
+	tokens := make([]string, 0, len(r.originals))
+	for token := range r.originals {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if len(tokens[i]) != len(tokens[j]) {
+			return len(tokens[i]) > len(tokens[j])
+		}
+		return tokens[i] < tokens[j]
+	})
+
+	pairs := make([]string, 0, 2*len(tokens))
+	for _, token := range tokens {
+		pairs = append(pairs, token, r.originals[token])
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// RedactText replaces every value already tokenized by this redactor in free
+// text, longest values first, so text written about restored users can be
+// sent back to the model.
+func (r *Redactor) RedactText(text string) string {
+	if len(r.tokens) == 0 {
+		return text
+	}
+
+	// A value tokenized as two fields has two tokens; use the smaller one so
+	// the text is the same every time
+	tokensByValue := make(map[string]string, len(r.originals))
+	for token, value := range r.originals {
+		if existing, ok := tokensByValue[value]; !ok || token < existing {
+			tokensByValue[value] = token
+		}
+	}
+	values := make([]string, 0, len(tokensByValue))
+	for value := range tokensByValue {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+
+	pairs := make([]string, 0, 2*len(values))
+	for _, value := range values {
+		pairs = append(pairs, value, tokensByValue[value])
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// RedactPlan returns a copy of a restored plan with its accounts, numbers and
+// free text tokenized again, for sending it back to the model.
+func (r *Redactor) RedactPlan(plan *MigrationPlan) *MigrationPlan {
+	redacted := plan.clone()
+	for _, items := range [][]AccountWithPriority{redacted.RecommendedOrder, redacted.Excluded} {
+		for i := range items {
+			items[i].Account = r.RedactUsers([]CanonicalUser{items[i].Account})[0]
+			items[i].Reason = r.RedactText(items[i].Reason)
+		}
+	}
+	for i := range redacted.NumberPlan {
+		item := &redacted.NumberPlan[i]
+		item.Number = r.RedactNumbers([]CanonicalNumber{item.Number})[0]
+		item.Reason = r.RedactText(item.Reason)
+	}
+	redacted.Reasoning = r.RedactText(redacted.Reasoning)
+	redacted.RiskAssessment = r.RedactText(redacted.RiskAssessment)
+	for i := range redacted.TodoList {
+		redacted.TodoList[i].Description = r.RedactText(redacted.TodoList[i].Description)
+		redacted.TodoList[i].Action = r.RedactText(redacted.TodoList[i].Action)
+	}
+	return redacted
+}
+
+// RestorePlan re-hydrates the accounts and free-text fields of a plan built
+// from redacted users.
+func (r *Redactor) RestorePlan(plan *MigrationPlan) {
+	for i := range plan.RecommendedOrder {
+		item := &plan.RecommendedOrder[i]
+		item.Account = r.RestoreUser(item.Account)
+		item.Reason = r.RestoreText(item.Reason)
+	}
+	for i := range plan.Excluded {
+		item := &plan.Excluded[i]
+		item.Account = r.RestoreUser(item.Account)
+		item.Reason = r.RestoreText(item.Reason)
+	}
+	for i := range plan.NumberPlan {
+		item := &plan.NumberPlan[i]
+		item.Number.Number = r.restoreValue(item.Number.Number)
+		item.Reason = r.RestoreText(item.Reason)
+	}
+	plan.Reasoning = r.RestoreText(plan.Reasoning)
+	plan.RiskAssessment = r.RestoreText(plan.RiskAssessment)
+	for i := range plan.TodoList {
+		plan.TodoList[i].Description = r.RestoreText(plan.TodoList[i].Description)
+		plan.TodoList[i].Action = r.RestoreText(plan.TodoList[i].Action)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRedactionPolicy(t *testing.T) {
+	policy, err := parseRedactionPolicy(" account_sid=hash, email=none ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(policy, RedactionPolicy{"id": redactHash}) {
+		t.Errorf("policy = %v", policy)
+	}
+	if got := policy.Describe()["email"]; got != redactNone {
+		t.Errorf("Describe()[email] = %q, want none", got)
+	}
+
+	if policy, _ := parseRedactionPolicy(""); !reflect.DeepEqual(policy, defaultRedactionPolicy) {
+		t.Errorf("empty spec = %v, want the default policy", policy)
+	}
+	if policy, _ := parseRedactionPolicy("off"); len(policy) != 0 {
+		t.Errorf("off = %v, want no redaction", policy)
+	}
+	for _, spec := range []string{"email", "status=hash", "email=encrypt"} {
+		if _, err := parseRedactionPolicy(spec); err == nil {
+			t.Errorf("parseRedactionPolicy(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestRedactorRoundTrip(t *testing.T) {
+	users := []CanonicalUser{
+		{ID: "AC1", Name: "John Doe", Email: "john@example.com", PhoneNumber: "+15551230001", Status: "active"},
+		{ID: "AC2", Name: "Jane Doe", Email: "jane@example.com", PhoneNumber: "+15559990001", Status: "active"},
+		{ID: "AC3", Name: "John Doe", Email: "", PhoneNumber: "+15551230001", Status: "inactive"},
+	}
+	policy := RedactionPolicy{"name": redactHash, "email": redactMask, "phone_number": redactMask}
+	redactor := mustRedactor(t, policy)
+
+	redacted := redactor.RedactUsers(users)
+
+	// john@ and jane@ share the mask j***@example.com, as do both numbers
+	if redacted[0].Email != "j***@example.com" || redacted[1].Email != "j***2@example.com" {
+		t.Errorf("emails = %q, %q", redacted[0].Email, redacted[1].Email)
+	}
+	if redacted[0].PhoneNumber != "+15*******01" || redacted[1].PhoneNumber != "+15*******01#2" {
+		t.Errorf("phone numbers = %q, %q", redacted[0].PhoneNumber, redacted[1].PhoneNumber)
+	}
+	// Repeated values reuse their token, and empty values stay empty
+	if redacted[2].Name != redacted[0].Name || redacted[2].PhoneNumber != redacted[0].PhoneNumber || redacted[2].Email != "" {
+		t.Errorf("third user = %+v", redacted[2])
+	}
+	if strings.Contains(redacted[0].Name, "John") || redacted[0].ID != "AC1" {
+		t.Errorf("first user = %+v", redacted[0])
+	}
+
+	for i, user := range redacted {
+		if restored := redactor.RestoreUser(user); restored != users[i] {
+			t.Errorf("RestoreUser = %+v, want %+v", restored, users[i])
+		}
+	}
+
+	text := "Call " + redacted[1].PhoneNumber + " before " + redacted[0].PhoneNumber + ", then email " + redacted[1].Email + "."
+	if got, want := redactor.RestoreText(text), "Call +15559990001 before +15551230001, then email jane@example.com."; got != want {
+		t.Errorf("RestoreText = %q, want %q", got, want)
+	}
+
+	// Same data and key, same tokens
+	if again := mustRedactor(t, policy).RedactUsers(users); !reflect.DeepEqual(again, redacted) {
+		t.Errorf("second redactor produced %+v", again)
+	}
+}
+
+func TestPlanMigrationOrderRedactsPrompt(t *testing.T) {
+	users := []CanonicalUser{{ID: "AC1", Name: "Priya Natarajan", Email: "priya@corp.example", PhoneNumber: "+15551230001", Status: "active"}}
+	redacted := mustRedactor(t, defaultRedactionPolicy).RedactUsers(users)[0]
+
+	plan := offlineTestPlan(t)
+	plan.RecommendedOrder = []AccountWithPriority{{Account: redacted, Priority: 1, Reason: "Move " + redacted.Name + " first", Risk: "low"}}
+	response, _ := json.Marshal(plan)
+	provider := &scriptedProvider{responses: []string{string(response)}}
+	migrator := testMigrator(provider)
+	migrator.redaction = defaultRedactionPolicy
+
+	restored, err := migrator.PlanMigrationOrder(context.Background(), &CanonicalPhoneSystem{Users: users}, "RingCentral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prompt := provider.sent[0][0].Content; strings.Contains(prompt, "priya@corp.example") || strings.Contains(prompt, "Priya Natarajan") {
+		t.Error("prompt contains the original email or name")
+	}
+	if restored.RecommendedOrder[0].Account != users[0] || restored.RecommendedOrder[0].Reason != "Move Priya Natarajan first" {
+		t.Errorf("restored entry = %+v", restored.RecommendedOrder[0])
+	}
+}
+
+func TestRedactionKeyIsNeverEmpty(t *testing.T) {
+	t.Setenv(redactionKeyEnv, "")
+	key, err := redactionKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 32 || bytes.Equal(key, make([]byte, 32)) {
+		t.Fatalf("run key = %x", key)
+	}
+	if again, _ := redactionKey(); !bytes.Equal(again, key) {
+		t.Error("run key changed within the run")
+	}
+
+	t.Setenv(redactionKeyEnv, "shared secret")
+	if got, _ := redactionKey(); string(got) != "shared secret" {
+		t.Errorf("configured key = %q", got)
+	}
+}
+
+func TestRedactionKeyID(t *testing.T) {
+	t.Setenv(redactionKeyEnv, "shared secret")
+	id, err := redactionKeyID(defaultRedactionPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(id) != 12 || strings.Contains(id, "shared") || id != mustRedactor(t, defaultRedactionPolicy).KeyID() {
+		t.Errorf("key ID = %q", id)
+	}
+
+	t.Setenv(redactionKeyEnv, "another secret")
+	if other, _ := redactionKeyID(defaultRedactionPolicy); other == id {
+		t.Error("two keys share an ID")
+	}
+	// Masks do not depend on the key
+	if id, _ := redactionKeyID(RedactionPolicy{"email": redactMask}); id != "" {
+		t.Errorf("key ID without hashed fields = %q", id)
+	}
+}
+
+// A conversation recorded in one run replays in a later one, whose redactor
+// makes the same tokens from the same key.
+func TestRedactedExchangesReplay(t *testing.T) {
+	t.Setenv(redactionKeyEnv, "shared secret")
+	system := &CanonicalPhoneSystem{Users: []CanonicalUser{
+		{ID: "AC1", Name: "Priya Natarajan", Email: "priya@corp.example", PhoneNumber: "+15551230001", Status: "active"},
+	}}
+	plan := offlineTestPlan(t)
+	plan.RecommendedOrder = []AccountWithPriority{{
+		Account: mustRedactor(t, defaultRedactionPolicy).RedactUsers(system.Users)[0], Priority: 1, Reason: "only user", Risk: "low",
+	}}
+	planJSON, _ := json.Marshal(plan)
+	body, _ := json.Marshal(map[string]interface{}{"content": []map[string]string{{"type": "text", "text": string(planJSON)}}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(body) }))
+	defer server.Close()
+
+	log := filepath.Join(t.TempDir(), "calls.jsonl")
+	live, err := NewEngineRoomEnhancedMigrator(LLMConfig{Provider: providerAnthropic, APIKey: "key", BaseURL: server.URL, RecordFile: log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := live.PlanMigrationOrder(context.Background(), system, "RingCentral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, _ := redactionKeyID(defaultRedactionPolicy)
+	if data, _ := ioutil.ReadFile(log); !strings.Contains(string(data), `"redaction_key_id":"`+keyID+`"`) || recorded.RedactionKeyID != keyID {
+		t.Fatalf("key ID %s not recorded in the log or plan: %s", keyID, data)
+	}
+
+	replayConfig := LLMConfig{Provider: providerReplay, FixtureFile: log}
+	replay, err := NewEngineRoomEnhancedMigrator(replayConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := replay.PlanMigrationOrder(context.Background(), system, "RingCentral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.RecommendedOrder[0].Account != system.Users[0] {
+		t.Errorf("replayed plan = %+v", replayed.RecommendedOrder)
+	}
+
+	// Without the key, or with another one, no prompt hash could match
+	t.Setenv(redactionKeyEnv, "")
+	if _, err := NewEngineRoomEnhancedMigrator(replayConfig); err == nil || !strings.Contains(err.Error(), redactionKeyEnv) {
+		t.Errorf("replay without a key: %v", err)
+	}
+	t.Setenv(redactionKeyEnv, "another secret")
+	if _, err := NewEngineRoomEnhancedMigrator(replayConfig); err == nil || !strings.Contains(err.Error(), keyID) {
+		t.Errorf("replay with another key: %v", err)
+	}
+}
+
+func mustRedactor(t *testing.T, policy RedactionPolicy) *Redactor {
+	t.Helper()
+	redactor, err := newRedactor(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return redactor
+}
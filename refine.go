@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// PlanRevision is one change Engine Room AI made to the plan on request.
+type PlanRevision struct {
+	Instruction string     `json:"instruction"`
+	Changes     []PlanEdit `json:"changes,omitempty"`
+}
+
+// One instruction in the plan chat and what came of it
+type chatTurn struct {
+	Instruction string
+	Reply       string // empty while Engine Room AI is working on it
+	Failed      bool
+}
+
+// planRefinement is a conversation with Engine Room AI about the plan being
+// confirmed. The migrator and redactor last as long as the conversation, so
+// tokens stay the same and every turn counts against one budget.
+type planRefinement struct {
+	migrator *EngineRoomEnhancedMigrator
+	redactor *Redactor
+	messages []EngineRoomMessage
+	sentPlan string // the plan as the model last saw it, to tell when it was edited since
+}
+
+func newPlanRefinement(config LLMConfig, plan *MigrationPlan) (*planRefinement, error) {
+	migrator, err := NewEngineRoomEnhancedMigrator(config)
+	if err != nil {
+		return nil, err
+	}
+	// Calls made while generating the plan count against the same budget
+	if plan.Usage != nil {
+		migrator.usage.calls = append([]CallUsage(nil), plan.Usage.Calls...)
+	}
+	redactor, err := newRedactor(migrator.redaction)
+	if err != nil {
+		return nil, err
+	}
+	return &planRefinement{migrator: migrator, redactor: redactor}, nil
+}
+
+// revise asks for plan to be changed as instruction says and returns the
+// revised plan, reconciled against system, with the conversation continued.
+func (r planRefinement) revise(ctx context.Context, plan *MigrationPlan, system *CanonicalPhoneSystem, targetFormat, instruction string) (*MigrationPlan, *planRefinement, error) {
+	// Tokenize every source record first so free text about any of them is
+	// redacted too
+	r.redactor.RedactUsers(system.Users)
+	r.redactor.RedactNumbers(system.Numbers)
+
+	current, err := r.planContent(plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	var prompt string
+	switch {
+	case len(r.messages) == 0:
+		prompt = refinementPrompt(current, targetFormat, instruction)
+	case current != r.sentPlan:
+		prompt = editedRefinementPrompt(current, instruction)
+	default:
+		prompt = followUpRefinementPrompt(instruction)
+	}
+
+	validate := validateMigrationPlan
+	if len(system.Numbers) > 0 {
+		validate = requireNumberPlan(validateMigrationPlan)
+	}
+	messages := append(append([]EngineRoomMessage(nil), r.messages...), EngineRoomMessage{Role: "user", Content: prompt})
+	revised, messages, err := r.migrator.requestPlanInConversation(ctx, messages, validate)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.redactor.RestorePlan(revised)
+
+	// Excluded accounts must still be source accounts
+	sourceIDs := make(map[string]bool, len(system.Users))
+	for _, user := range system.Users {
+		sourceIDs[user.ID] = true
+	}
+	var excluded []AccountWithPriority
+	for _, item := range revised.Excluded {
+		if sourceIDs[item.Account.ID] {
+			excluded = append(excluded, item)
+			delete(sourceIDs, item.Account.ID)
+		}
+	}
+	revised.Excluded = excluded
+	revised.Reconciliation = nil
+	reconcilePlan(revised, system.Users)
+	reconcileNumberPlan(revised, system.Numbers, targetFormat)
+
+	r.messages = messages
+	if r.sentPlan, err = r.planContent(revised); err != nil {
+		return nil, nil, err
+	}
+
+	revised.GeneratedBy = plan.GeneratedBy
+	revised.RedactionKeyID = r.redactor.KeyID()
+	revised.Repairs += plan.Repairs
+	revised.Usage = r.migrator.Usage()
+	revised.Edits = nil
+	revised.Revisions = append(append([]PlanRevision(nil), plan.Revisions...), PlanRevision{
+		Instruction: instruction,
+		Changes:     diffPlans(plan, revised),
+	})
+	return revised, &r, nil
+}
+
+// planContent is the redacted JSON of the parts of a plan the model works
+// on, leaving out what this tool adds to it.
+func (r planRefinement) planContent(plan *MigrationPlan) (string, error) {
+	content := r.redactor.RedactPlan(plan)
+	content.GeneratedBy = ""
+	content.RedactionKeyID = ""
+	content.Repairs = 0
+	content.Usage = nil
+	content.Reconciliation = nil
+	content.Edits = nil
+	content.Revisions = nil
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func refinementPrompt(planJSON, targetFormat, instruction string) string {
+	return fmt.Sprintf(`You are a phone system migration expert. This is the current plan for migrating a phone system to %s:
+
+%s
+
+%s
+
+Revise the plan as follows: %s
+
+Respond with the complete revised plan as a JSON object in the same format. Keep every account in "recommended_order" unless the instruction leaves it out of the migration, and list accounts left out in "excluded". Keep every phone number in "number_plan". Number priorities and to-do steps from 1 without gaps.
+Set "executor" on each step to the automated operation that performs it: backup, validate, order, convert_users, convert_numbers, roundtrip, verify or write.
+Use "manual" for steps that need a person to act, such as notifying users.`, targetFormat, planJSON, targetCapabilitiesNote(targetFormat), instruction)
+}
+
+func editedRefinementPrompt(planJSON, instruction string) string {
+	return fmt.Sprintf(`The plan was edited by hand since your last revision. This is the current plan:
+
+%s
+
+Revise it as follows: %s
+
+Respond with the complete revised plan as a JSON object in the same format as before.`, planJSON, instruction)
+}
+
+func followUpRefinementPrompt(instruction string) string {
+	return fmt.Sprintf(`Revise the plan further: %s
+
+Respond with the complete revised plan as a JSON object in the same format as before.`, instruction)
+}
+
+type planRevisedMsg struct {
+	plan       *MigrationPlan
+	refinement *planRefinement
+	err        error
+}
+
+// refinePlan sends one chat instruction, starting the conversation on the
+// first one.
+func refinePlan(ctx context.Context, config MigrationConfig, refinement *planRefinement, plan *MigrationPlan, instruction string) tea.Cmd {
+	return func() tea.Msg {
+		if refinement == nil {
+			var err error
+			if refinement, err = newPlanRefinement(config.LLM, plan); err != nil {
+				return planRevisedMsg{err: err}
+			}
+		}
+		system, err := decodeSourceFile(config)
+		if err != nil {
+			return planRevisedMsg{err: err}
+		}
+		revised, next, err := refinement.revise(ctx, plan, system, config.TargetFormat, instruction)
+		if err != nil {
+			// Keep the session so spent calls still count against the budget
+			return planRevisedMsg{refinement: refinement, err: err}
+		}
+		return planRevisedMsg{plan: revised, refinement: next}
+	}
+}
+
+// canRefinePlan reports whether the plan came from Engine Room AI, which is
+// needed to chat about it.
+func (m model) canRefinePlan() bool {
+	return m.migrationPlan != nil && m.migrationPlan.GeneratedBy == planGeneratorEngineRoom
+}
+
+func (m model) startPlanChat() model {
+	m.chatting = true
+	m.textInput.SetValue("")
+	m.textInput.Placeholder = "e.g. migrate inactive users last..."
+	m.textInput.Focus()
+	return m
+}
+
+func (m model) updatePlanChat(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m.quit()
+	case "esc":
+		// Keep the pane open until a pending reply has arrived
+		if !m.chatPending {
+			m.chatting = false
+		}
+		return m, nil
+	case "enter":
+		instruction := strings.TrimSpace(m.textInput.Value())
+		if m.chatPending || instruction == "" {
+			return m, nil
+		}
+		m.chatPending = true
+		m.chatLog = append(m.chatLog, chatTurn{Instruction: instruction})
+		m.textInput.SetValue("")
+		return m, tea.Batch(m.spinner.Tick, refinePlan(m.ctx, m.config, m.refinement, m.migrationPlan, instruction))
+	}
+	var cmd tea.Cmd
+	m.textInput, cmd = m.textInput.Update(msg)
+	return m, cmd
+}
+
+// applyPlanRevision shows the revised plan with its changes highlighted.
+// The changes are recorded only as a revision; edits made after it are
+// diffed against the revised plan.
+func (m model) applyPlanRevision(msg planRevisedMsg) model {
+	m.chatPending = false
+	if msg.refinement != nil {
+		m.refinement = msg.refinement
+	}
+	turn := &m.chatLog[len(m.chatLog)-1]
+	if msg.err != nil {
+		turn.Reply = fmt.Sprintf("Could not revise the plan: %v", msg.err)
+		turn.Failed = true
+		return m
+	}
+
+	edits := m.migrationPlan.Edits
+	m.migrationPlan = msg.plan
+	m.migrationPlan.Edits = edits
+	m.originalPlan = m.migrationPlan.clone()
+	m.lastChanges = msg.plan.Revisions[len(msg.plan.Revisions)-1].Changes
+
+	turn.Reply = "No changes to the plan"
+	if len(m.lastChanges) > 0 {
+		turn.Reply = fmt.Sprintf("Revised the plan: %d change(s), highlighted above", len(m.lastChanges))
+	}
+	return m
+}
+
+// changedSubjects indexes the accounts and steps touched by edits.
+func changedSubjects(edits []PlanEdit) map[string]bool {
+	subjects := make(map[string]bool, len(edits))
+	for _, edit := range edits {
+		subjects[edit.Subject] = true
+	}
+	return subjects
+}
+
+func (m model) planChatView() string {
+	var s strings.Builder
+
+	s.WriteString(subtitleStyle.Render("💬 Refine with Engine Room AI:"))
+	s.WriteString("\n")
+	for _, turn := range m.chatLog {
+		s.WriteString(fmt.Sprintf("You: %s\n", turn.Instruction))
+		switch {
+		case turn.Reply == "":
+			s.WriteString(fmt.Sprintf("%s Engine Room AI is revising the plan...\n", m.spinner.View()))
+		case turn.Failed:
+			s.WriteString(errorStyle.Render("Engine Room AI: "+turn.Reply) + "\n")
+		default:
+			s.WriteString(aiStyle.Render("Engine Room AI: "+turn.Reply) + "\n")
+		}
+	}
+	if m.chatting {
+		s.WriteString(m.textInput.View())
+		s.WriteString("\n")
+		s.WriteString(helpStyle.Render("Enter to send, Esc to close the chat"))
+		s.WriteString("\n")
+	}
+	return s.String()
+}
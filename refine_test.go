@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanRefinementRevise(t *testing.T) {
+	system := &CanonicalPhoneSystem{Users: []CanonicalUser{
+		{ID: "a", Name: "User a", Status: "active"},
+		{ID: "b", Name: "User b", Status: "active"},
+		{ID: "c", Name: "User c", Status: "active"},
+	}}
+	plan := offlineTestPlan(t)
+	plan.RecommendedOrder = nil
+	for i, user := range system.Users {
+		plan.RecommendedOrder = append(plan.RecommendedOrder, AccountWithPriority{Account: user, Priority: i + 1, Reason: "planned", Risk: "low"})
+	}
+	plan.GeneratedBy = planGeneratorEngineRoom
+
+	// First answer moves c to the front and excludes b and an unknown account
+	first := plan.clone()
+	first.RecommendedOrder = []AccountWithPriority{first.RecommendedOrder[2], first.RecommendedOrder[0]}
+	first.RecommendedOrder[0].Priority, first.RecommendedOrder[1].Priority = 1, 2
+	first.Excluded = []AccountWithPriority{plan.RecommendedOrder[1], {Account: CanonicalUser{ID: "zz"}}}
+	firstJSON, _ := json.Marshal(first)
+
+	provider := &scriptedProvider{responses: []string{string(firstJSON), string(firstJSON), string(firstJSON)}}
+	migrator := testMigrator(provider)
+	refinement := &planRefinement{migrator: migrator, redactor: mustRedactor(t, RedactionPolicy{})}
+
+	revised, refinement, err := refinement.revise(context.Background(), plan, system, "Twilio", "Move c first and skip b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := plannedIDs(revised); strings.Join(ids, ",") != "c,a" {
+		t.Errorf("order = %v, want c,a", ids)
+	}
+	if len(revised.Excluded) != 1 || revised.Excluded[0].Account.ID != "b" {
+		t.Errorf("excluded = %+v, want only b", revised.Excluded)
+	}
+	if len(revised.Revisions) != 1 || revised.Revisions[0].Instruction != "Move c first and skip b" || len(revised.Revisions[0].Changes) == 0 {
+		t.Fatalf("revisions = %+v", revised.Revisions)
+	}
+	if revised.GeneratedBy != planGeneratorEngineRoom {
+		t.Errorf("GeneratedBy = %q", revised.GeneratedBy)
+	}
+
+	// A follow-up only sends the instruction, on top of the conversation
+	again, refinement, err := refinement.revise(context.Background(), revised, system, "Twilio", "Looks good")
+	if err != nil {
+		t.Fatal(err)
+	}
+	followUp := provider.sent[1]
+	if len(followUp) != 3 || !strings.HasPrefix(followUp[2].Content, "Revise the plan further: Looks good") {
+		t.Errorf("follow-up conversation = %+v", followUp)
+	}
+	if len(again.Revisions) != 2 || len(again.Revisions[1].Changes) != 0 {
+		t.Errorf("unchanged revision recorded changes: %+v", again.Revisions)
+	}
+
+	// After a hand edit the model is shown the edited plan
+	again.moveAccount(1, 0)
+	if _, _, err := refinement.revise(context.Background(), again, system, "Twilio", "Keep it"); err != nil {
+		t.Fatal(err)
+	}
+	if edited := provider.sent[2]; !strings.HasPrefix(edited[len(edited)-1].Content, "The plan was edited by hand") {
+		t.Errorf("edited plan was not resent: %s", edited[len(edited)-1].Content)
+	}
+}
+
+func TestApplyPlanRevisionKeepsEditsApart(t *testing.T) {
+	m := initialModel()
+	m.migrationPlan = testPlan()
+
+	m = m.startEditingPlan()
+	m.migrationPlan.moveAccount(4, 0)
+	m = m.finishEditingPlan()
+
+	// Engine Room AI raises the risk of Write, which is a revision, not an edit
+	revised := m.migrationPlan.clone()
+	revised.Edits = nil
+	revised.TodoList[2].Risk = "high"
+	revised.Revisions = []PlanRevision{{
+		Instruction: "Writing is risky",
+		Changes:     []PlanEdit{{Kind: editStepRisk, Subject: "Write", Detail: "risk changed from low to high"}},
+	}}
+	m.chatLog = []chatTurn{{Instruction: "Writing is risky"}}
+	m = m.applyPlanRevision(planRevisedMsg{plan: revised})
+
+	m = m.startEditingPlan()
+	m.migrationPlan.TodoList[1].Risk = "medium"
+	m = m.finishEditingPlan()
+
+	var got []string
+	for _, edit := range m.migrationPlan.Edits {
+		got = append(got, edit.Kind+" "+edit.Subject)
+	}
+	if want := []string{"moved_account e", "step_risk_changed Convert"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("edits = %v, want %v", got, want)
+	}
+	if len(m.migrationPlan.Revisions) != 1 || m.migrationPlan.TodoList[2].Risk != "high" {
+		t.Errorf("revision lost: %+v", m.migrationPlan.Revisions)
+	}
+}
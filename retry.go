@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Engine Room AI error kinds
+const (
+	apiErrorAuth       = "auth"
+	apiErrorRateLimit  = "rate_limit"
+	apiErrorOverloaded = "overloaded"
+	apiErrorBadRequest = "bad_request"
+	apiErrorServer     = "server"
+	apiErrorNetwork    = "network"
+)
+
+// EngineRoomAPIError is a classified failure from an Engine Room AI backend.
+type EngineRoomAPIError struct {
+	Kind       string
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // from the retry-after header, zero if absent
+}
+
+func (e *EngineRoomAPIError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("Engine Room AI %s error: %s", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("Engine Room AI %s error (HTTP %d): %s", e.Kind, e.StatusCode, e.Message)
+}
+
+// Retryable reports whether sending the same request again may succeed.
+func (e *EngineRoomAPIError) Retryable() bool {
+	switch e.Kind {
+	case apiErrorRateLimit, apiErrorOverloaded, apiErrorServer, apiErrorNetwork:
+		return true
+	}
+	return false
+}
+
+// classifyHTTPError builds an EngineRoomAPIError from a non-200 response.
+func classifyHTTPError(resp *http.Response, body []byte) *EngineRoomAPIError {
+	apiErr := &EngineRoomAPIError{
+		StatusCode: resp.StatusCode,
+		Message:    errorMessage(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("retry-after")),
+	}
+
+	switch {
+	case resp.StatusCode == 401 || resp.StatusCode == 403:
+		apiErr.Kind = apiErrorAuth
+	case resp.StatusCode == 429:
+		apiErr.Kind = apiErrorRateLimit
+	case resp.StatusCode == 503 || resp.StatusCode == 529:
+		apiErr.Kind = apiErrorOverloaded
+	case resp.StatusCode >= 500:
+		apiErr.Kind = apiErrorServer
+	default:
+		apiErr.Kind = apiErrorBadRequest
+	}
+	return apiErr
+}
+
+// errorMessage extracts error.message from Anthropic and OpenAI style error
+// bodies, falling back to the raw body.
+func errorMessage(body []byte) string {
+	var parsed struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Error.Message != "" {
+		return parsed.Error.Message
+	}
+	return string(body)
+}
+
+// parseRetryAfter accepts both the delay-seconds and HTTP-date forms.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// RetryPolicy bounds how often and how long a failed call is retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// delay returns the wait before the given retry (1 for the first retry):
+// the server's retry-after if it sent one, otherwise exponential backoff
+// with jitter between half and the full delay. It reports false when the
+// server asks for a longer wait than MaxDelay, which is not worth retrying.
+func (p RetryPolicy) delay(retry int, apiErr *EngineRoomAPIError) (time.Duration, bool) {
+	if apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter, apiErr.RetryAfter <= p.MaxDelay
+	}
+
+	backoff := p.BaseDelay << uint(retry-1)
+	if backoff <= 0 || backoff > p.MaxDelay {
+		backoff = p.MaxDelay
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)), true
+}
+
+// retryingProvider retries retryable failures of the wrapped provider until
+// the attempt budget runs out or the context is cancelled.
+type retryingProvider struct {
+	inner  LLMProvider
+	policy RetryPolicy
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+func newRetryingProvider(inner LLMProvider, policy RetryPolicy) *retryingProvider {
+	return &retryingProvider{inner: inner, policy: policy, sleep: sleepContext}
+}
+
+func (p *retryingProvider) Name() string { return p.inner.Name() }
+
+func (p *retryingProvider) Complete(ctx context.Context, messages []EngineRoomMessage) (*LLMResponse, error) {
+	attempts := p.policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		response, err := p.inner.Complete(ctx, messages)
+		if err == nil {
+			return response, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var apiErr *EngineRoomAPIError
+		if !errors.As(err, &apiErr) || !apiErr.Retryable() {
+			return nil, err
+		}
+		if attempt == attempts {
+			return nil, fmt.Errorf("giving up after %d attempt(s): %w", attempts, err)
+		}
+
+		delay, ok := p.policy.delay(attempt, apiErr)
+		if !ok {
+			return nil, fmt.Errorf("not retrying, the server asked to wait %v, more than %v: %w", delay, p.policy.MaxDelay, err)
+		}
+		if err := p.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
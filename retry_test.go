@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("2.5"); got != 2500*time.Millisecond {
+		t.Errorf("seconds form = %v, want 2.5s", got)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 58*time.Second || got > time.Minute {
+		t.Errorf("date form = %v, want about a minute", got)
+	}
+	for _, value := range []string{"", "0", "-3", "soon", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)} {
+		if got := parseRetryAfter(value); got != 0 {
+			t.Errorf("parseRetryAfter(%q) = %v, want 0", value, got)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	// Jitter keeps each delay between half and all of the backoff
+	for retry, backoff := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 5: time.Second, 64: time.Second} {
+		for i := 0; i < 20; i++ {
+			if got, ok := policy.delay(retry, &EngineRoomAPIError{Kind: apiErrorServer}); !ok || got < backoff/2 || got > backoff {
+				t.Fatalf("delay(%d) = %v, %t, want between %v and %v", retry, got, ok, backoff/2, backoff)
+			}
+		}
+	}
+
+	if got, ok := policy.delay(1, &EngineRoomAPIError{Kind: apiErrorRateLimit, RetryAfter: 700 * time.Millisecond}); !ok || got != 700*time.Millisecond {
+		t.Errorf("delay with retry-after = %v, %t, want 700ms", got, ok)
+	}
+	if got, ok := policy.delay(1, &EngineRoomAPIError{Kind: apiErrorRateLimit, RetryAfter: time.Hour}); ok {
+		t.Errorf("delay with a retry-after over MaxDelay = %v, want it refused", got)
+	}
+}
+
+// flakyProvider fails with each error in turn, then succeeds.
+type flakyProvider struct {
+	errs  []error
+	calls int
+}
+
+func (p *flakyProvider) Name() string { return "flaky" }
+
+func (p *flakyProvider) Complete(ctx context.Context, messages []EngineRoomMessage) (*LLMResponse, error) {
+	p.calls++
+	if p.calls <= len(p.errs) {
+		return nil, p.errs[p.calls-1]
+	}
+	return &LLMResponse{Text: "ok"}, nil
+}
+
+func TestRetryingProvider(t *testing.T) {
+	overloaded := &EngineRoomAPIError{Kind: apiErrorOverloaded, StatusCode: 529}
+	var slept []time.Duration
+	retrying := func(inner LLMProvider, attempts int) *retryingProvider {
+		p := newRetryingProvider(inner, RetryPolicy{MaxAttempts: attempts, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+		p.sleep = func(ctx context.Context, d time.Duration) error {
+			slept = append(slept, d)
+			return ctx.Err()
+		}
+		return p
+	}
+
+	inner := &flakyProvider{errs: []error{overloaded, &EngineRoomAPIError{Kind: apiErrorNetwork}}}
+	if resp, err := retrying(inner, 3).Complete(context.Background(), nil); err != nil || resp.Text != "ok" {
+		t.Fatalf("Complete = %+v, %v", resp, err)
+	}
+	if inner.calls != 3 || len(slept) != 2 {
+		t.Errorf("%d calls and %d sleeps, want 3 and 2", inner.calls, len(slept))
+	}
+
+	inner = &flakyProvider{errs: []error{overloaded, overloaded}}
+	if _, err := retrying(inner, 2).Complete(context.Background(), nil); !errors.Is(err, overloaded) || inner.calls != 2 {
+		t.Errorf("after %d calls err = %v, want the last overloaded error", inner.calls, err)
+	}
+
+	// A server asking for a longer wait than the policy allows is not retried
+	slept = nil
+	rateLimited := &EngineRoomAPIError{Kind: apiErrorRateLimit, StatusCode: 429, RetryAfter: time.Minute}
+	inner = &flakyProvider{errs: []error{rateLimited}}
+	if _, err := retrying(inner, 5).Complete(context.Background(), nil); !errors.Is(err, rateLimited) || inner.calls != 1 || len(slept) != 0 {
+		t.Errorf("long retry-after: %d calls, %d sleeps, err %v", inner.calls, len(slept), err)
+	}
+
+	auth := &EngineRoomAPIError{Kind: apiErrorAuth, StatusCode: 401}
+	inner = &flakyProvider{errs: []error{auth}}
+	if _, err := retrying(inner, 5).Complete(context.Background(), nil); err != auth || inner.calls != 1 {
+		t.Errorf("auth error was retried: %d calls, err %v", inner.calls, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	inner = &flakyProvider{errs: []error{overloaded}}
+	if _, err := retrying(inner, 5).Complete(ctx, nil); err != context.Canceled {
+		t.Errorf("cancelled call returned %v", err)
+	}
+}
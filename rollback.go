@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// RollbackRecord is what a migration records to be reversed: checksums of
+// the data it read and wrote, and the target file it replaced. JSON
+// checksums are of the compacted JSON, so they survive the re-indenting of
+// the enhanced output.
+type RollbackRecord struct {
+	SourceFile           string `json:"source_file"`
+	SourceSHA256         string `json:"source_sha256"`
+	TargetFile           string `json:"target_file"`
+	ConvertedSHA256      string `json:"converted_sha256"`
+	TargetExisted        bool   `json:"target_existed"`
+	PreviousTarget       []byte `json:"previous_target,omitempty"`
+	PreviousTargetSHA256 string `json:"previous_target_sha256,omitempty"`
+}
+
+// RollbackCheckError lists the checksums that did not match, so nothing was
+// restored.
+type RollbackCheckError struct {
+	Problems []string
+}
+
+func (e *RollbackCheckError) Error() string {
+	return fmt.Sprintf("rollback refused: %s", strings.Join(e.Problems, "; "))
+}
+
+// Suffix of the file kept beside a plain converted target, which has no room
+// for the rollback record itself
+const rollbackFileSuffix = ".rollback.json"
+
+// Suffix the rollback record is renamed to once it has been applied
+const rolledBackSuffix = ".rolled-back"
+
+func jsonSHA256(data []byte) (string, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return "", err
+	}
+	return sha256Hex(compact.Bytes()), nil
+}
+
+// newRollbackRecord describes a migration of sourceData into convertedData,
+// saving whatever config.TargetFile holds before it is overwritten.
+func newRollbackRecord(config MigrationConfig, sourceData, convertedData []byte) (*RollbackRecord, error) {
+	record := &RollbackRecord{
+		SourceFile: config.SourceFile,
+		TargetFile: config.TargetFile,
+	}
+	var err error
+	if record.SourceSHA256, err = jsonSHA256(sourceData); err != nil {
+		return nil, fmt.Errorf("failed to checksum source data: %w", err)
+	}
+	if record.ConvertedSHA256, err = jsonSHA256(convertedData); err != nil {
+		return nil, fmt.Errorf("failed to checksum converted data: %w", err)
+	}
+
+	previous, err := ioutil.ReadFile(config.TargetFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s before overwriting it: %w", config.TargetFile, err)
+	}
+	if err == nil {
+		record.TargetExisted = true
+		record.PreviousTarget = previous
+		record.PreviousTargetSHA256 = sha256Hex(previous)
+	}
+	return record, nil
+}
+
+// writeRollbackFile records a migration whose target holds only the
+// converted data.
+func writeRollbackFile(record *RollbackRecord, sourceData []byte) error {
+	return writeJSONFile(record.TargetFile+rollbackFileSuffix, map[string]interface{}{
+		"rollback":      record,
+		"original_data": json.RawMessage(sourceData),
+	})
+}
+
+// What a rollback file holds, either the enhanced output or the file kept
+// beside a plain target
+type rollbackFile struct {
+	Rollback      *RollbackRecord `json:"rollback"`
+	OriginalData  json.RawMessage `json:"original_data"`
+	ConvertedData json.RawMessage `json:"converted_data"`
+}
+
+// RollbackMigration restores the state from before the migration that wrote
+// target: the source file and whatever target held. Every checksum is
+// verified before anything is changed, and files changed since the
+// migration are left alone. The rollback record is kept, renamed with a
+// .rolled-back suffix.
+func RollbackMigration(target string) ([]string, error) {
+	recordPath := target
+	data, err := ioutil.ReadFile(target)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", target, err)
+	}
+	var file rollbackFile
+	if err != nil || json.Unmarshal(data, &file) != nil || file.Rollback == nil {
+		// A plain target keeps its record beside it
+		recordPath = target + rollbackFileSuffix
+		file = rollbackFile{}
+		if data, err = ioutil.ReadFile(recordPath); err != nil {
+			return nil, fmt.Errorf("no rollback record in %s or %s: %w", target, recordPath, err)
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", recordPath, err)
+		}
+		if file.Rollback == nil {
+			return nil, fmt.Errorf("no rollback record in %s", recordPath)
+		}
+	}
+	record := file.Rollback
+	enhanced := recordPath == target
+
+	var problems []string
+	if len(file.OriginalData) == 0 {
+		problems = append(problems, "the original data is missing")
+	} else if sum, err := jsonSHA256(file.OriginalData); err != nil || sum != record.SourceSHA256 {
+		problems = append(problems, "the original data does not match its checksum")
+	}
+	if record.TargetExisted && sha256Hex(record.PreviousTarget) != record.PreviousTargetSHA256 {
+		problems = append(problems, "the previous target does not match its checksum")
+	}
+
+	// The converted data must still be what the migration wrote
+	converted := []byte(file.ConvertedData)
+	targetPresent := true
+	if !enhanced {
+		converted, err = ioutil.ReadFile(target)
+		if os.IsNotExist(err) {
+			targetPresent = false
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", target, err)
+		}
+	}
+	if targetPresent {
+		if sum, err := jsonSHA256(converted); err != nil || sum != record.ConvertedSHA256 {
+			problems = append(problems, fmt.Sprintf("%s has changed since the migration", target))
+		}
+	}
+
+	// The source is restored only if it is gone; a changed source is not overwritten
+	restoreSource := false
+	if current, err := ioutil.ReadFile(record.SourceFile); os.IsNotExist(err) {
+		restoreSource = true
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", record.SourceFile, err)
+	} else if sum, err := jsonSHA256(current); err != nil || sum != record.SourceSHA256 {
+		problems = append(problems, fmt.Sprintf("%s has changed since the migration", record.SourceFile))
+	}
+
+	if len(problems) > 0 {
+		return nil, &RollbackCheckError{Problems: problems}
+	}
+
+	var done []string
+	if restoreSource {
+		var original bytes.Buffer
+		if err := json.Indent(&original, file.OriginalData, "", "  "); err != nil {
+			return done, fmt.Errorf("failed to format the original data: %w", err)
+		}
+		if err := ioutil.WriteFile(record.SourceFile, original.Bytes(), 0644); err != nil {
+			return done, fmt.Errorf("failed to restore %s: %w", record.SourceFile, err)
+		}
+		done = append(done, fmt.Sprintf("Restored %s from the original data", record.SourceFile))
+	} else {
+		done = append(done, fmt.Sprintf("Verified %s is unchanged", record.SourceFile))
+	}
+
+	if err := os.Rename(recordPath, recordPath+rolledBackSuffix); err != nil {
+		return done, fmt.Errorf("failed to set aside %s: %w", recordPath, err)
+	}
+	done = append(done, fmt.Sprintf("Kept the rollback record as %s", recordPath+rolledBackSuffix))
+
+	switch {
+	case record.TargetExisted:
+		if err := ioutil.WriteFile(target, record.PreviousTarget, 0644); err != nil {
+			return done, fmt.Errorf("failed to restore %s: %w", target, err)
+		}
+		done = append(done, fmt.Sprintf("Restored the previous %s", target))
+	case targetPresent && !enhanced:
+		if err := os.Remove(target); err != nil {
+			return done, fmt.Errorf("failed to remove %s: %w", target, err)
+		}
+		done = append(done, fmt.Sprintf("Removed %s", target))
+	}
+	return done, nil
+}
+
+type rollbackDoneMsg struct {
+	done []string
+	err  error
+}
+
+// rollbackMigration undoes the migration just completed.
+func rollbackMigration(target string) tea.Cmd {
+	return func() tea.Msg {
+		done, err := RollbackMigration(target)
+		return rollbackDoneMsg{done, err}
+	}
+}
+
+// rollbackView is the outcome of rolling back from the completed screen.
+func (m model) rollbackView() string {
+	if !m.migrationUndone && m.rollbackErr == nil {
+		return ""
+	}
+	var s strings.Builder
+	s.WriteString("\n")
+	if m.rollbackErr != nil {
+		s.WriteString(errorStyle.Render(fmt.Sprintf("❌ Rollback failed: %v", m.rollbackErr)))
+		s.WriteString("\n")
+	} else {
+		s.WriteString(successStyle.Render("↩️  Migration rolled back"))
+		s.WriteString("\n")
+	}
+	for _, line := range m.rolledBack {
+		s.WriteString(fmt.Sprintf("• %s\n", line))
+	}
+	return s.String()
+}
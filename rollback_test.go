@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const rollbackSource = `{"users": [{"account_sid": "AC1", "friendly_name": "John", "email": "john@example.com", "phone_number": "+15551230001", "status": "active"}]}`
+
+// migrateForRollback writes a plain target for source with its rollback
+// record beside it, as the standard migration does. previous, if not nil,
+// is what the target held before.
+func migrateForRollback(t *testing.T, previous []byte) MigrationConfig {
+	dir := t.TempDir()
+	config := MigrationConfig{
+		SourceFile:   filepath.Join(dir, "twilio.json"),
+		TargetFile:   filepath.Join(dir, "ringcentral.json"),
+		SourceFormat: "Twilio",
+		TargetFormat: "RingCentral",
+	}
+	if err := ioutil.WriteFile(config.SourceFile, []byte(rollbackSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if previous != nil {
+		if err := ioutil.WriteFile(config.TargetFile, previous, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	converted, err := convertBetween("Twilio", "RingCentral", []byte(rollbackSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := newRollbackRecord(config, []byte(rollbackSource), converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(config.TargetFile, converted, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeRollbackFile(record, []byte(rollbackSource)); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+// editRollbackFile changes the rollback record beside target.
+func editRollbackFile(t *testing.T, target string, edit func(file map[string]interface{})) {
+	path := target + rollbackFileSuffix
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file map[string]interface{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	edit(file)
+	if err := writeJSONFile(path, file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollbackMigration(t *testing.T) {
+	previous := []byte("previous target\n")
+
+	tests := []struct {
+		name        string
+		previous    []byte
+		change      func(t *testing.T, config MigrationConfig)
+		wantRefused bool
+		wantTarget  []byte // nil when the target should be gone
+	}{
+		{
+			name:       "new target is removed",
+			change:     func(t *testing.T, config MigrationConfig) {},
+			wantTarget: nil,
+		},
+		{
+			name:       "previous target is restored",
+			previous:   previous,
+			change:     func(t *testing.T, config MigrationConfig) {},
+			wantTarget: previous,
+		},
+		{
+			name:   "missing source is restored",
+			change: func(t *testing.T, config MigrationConfig) { os.Remove(config.SourceFile) },
+		},
+		{
+			name: "target changed since the migration",
+			change: func(t *testing.T, config MigrationConfig) {
+				ioutil.WriteFile(config.TargetFile, []byte(`{"accounts": []}`), 0644)
+			},
+			wantRefused: true,
+		},
+		{
+			name: "source changed since the migration",
+			change: func(t *testing.T, config MigrationConfig) {
+				ioutil.WriteFile(config.SourceFile, []byte(`{"users": []}`), 0644)
+			},
+			wantRefused: true,
+		},
+		{
+			name: "original data tampered with",
+			change: func(t *testing.T, config MigrationConfig) {
+				editRollbackFile(t, config.TargetFile, func(file map[string]interface{}) {
+					file["original_data"] = map[string]interface{}{"users": []interface{}{}}
+				})
+			},
+			wantRefused: true,
+		},
+		{
+			name:     "previous target tampered with",
+			previous: previous,
+			change: func(t *testing.T, config MigrationConfig) {
+				editRollbackFile(t, config.TargetFile, func(file map[string]interface{}) {
+					file["rollback"].(map[string]interface{})["previous_target"] = []byte("something else")
+				})
+			},
+			wantRefused: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := migrateForRollback(t, tt.previous)
+			tt.change(t, config)
+			before, _ := ioutil.ReadFile(config.TargetFile)
+
+			_, err := RollbackMigration(config.TargetFile)
+			if tt.wantRefused {
+				var checkErr *RollbackCheckError
+				if !errors.As(err, &checkErr) {
+					t.Fatalf("RollbackMigration error = %v, want a RollbackCheckError", err)
+				}
+				// Nothing was touched
+				if after, _ := ioutil.ReadFile(config.TargetFile); string(after) != string(before) {
+					t.Error("target changed by a refused rollback")
+				}
+				if _, err := os.Stat(config.TargetFile + rollbackFileSuffix); err != nil {
+					t.Error("rollback record moved by a refused rollback")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			target, err := ioutil.ReadFile(config.TargetFile)
+			if tt.wantTarget == nil && !os.IsNotExist(err) {
+				t.Errorf("target still exists: %v", err)
+			}
+			if tt.wantTarget != nil && string(target) != string(tt.wantTarget) {
+				t.Errorf("target = %q, want %q", target, tt.wantTarget)
+			}
+			source, err := ioutil.ReadFile(config.SourceFile)
+			if err != nil {
+				t.Fatalf("source missing after rollback: %v", err)
+			}
+			if sum, _ := jsonSHA256(source); sum != mustJSONSHA256(t, rollbackSource) {
+				t.Errorf("source = %s, want the original data", source)
+			}
+			if _, err := os.Stat(config.TargetFile + rollbackFileSuffix + rolledBackSuffix); err != nil {
+				t.Errorf("rollback record not kept: %v", err)
+			}
+
+			// A second rollback has nothing to undo
+			if _, err := RollbackMigration(config.TargetFile); err == nil {
+				t.Error("second rollback succeeded")
+			}
+		})
+	}
+}
+
+func TestRollbackMigrationEnhancedTarget(t *testing.T) {
+	config := migrateForRollback(t, nil)
+	converted, _ := ioutil.ReadFile(config.TargetFile)
+	data, _ := ioutil.ReadFile(config.TargetFile + rollbackFileSuffix)
+	var sidecar rollbackFile
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(config.TargetFile + rollbackFileSuffix)
+
+	// The enhanced output holds its own record and stays as the audit trail
+	if err := writeJSONFile(config.TargetFile, map[string]interface{}{
+		"original_data":  json.RawMessage(rollbackSource),
+		"converted_data": json.RawMessage(converted),
+		"rollback":       sidecar.Rollback,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RollbackMigration(config.TargetFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(config.TargetFile + rolledBackSuffix); err != nil {
+		t.Errorf("enhanced output not kept as the rollback record: %v", err)
+	}
+}
+
+func mustJSONSHA256(t *testing.T, data string) string {
+	sum, err := jsonSHA256([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sum
+}
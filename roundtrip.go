@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Result of converting data to the target format and back again
+type RoundTripReport struct {
+	SourceFormat string               `json:"source_format"`
+	TargetFormat string               `json:"target_format"`
+	Lossless     bool                 `json:"lossless"`
+	Differences  []SystemDifference   `json:"differences"`
+	Unmapped     []UnmappedCapability `json:"unmapped_capabilities"`
+}
+
+// Summary is a one-line description of the round trip for step details.
+func (r *RoundTripReport) Summary() string {
+	path := fmt.Sprintf("%s → %s → %s", r.SourceFormat, r.TargetFormat, r.SourceFormat)
+	if r.Lossless {
+		return path + " is lossless"
+	}
+
+	var examples []string
+	for i, diff := range r.Differences {
+		if i == 3 {
+			examples = append(examples, "...")
+			break
+		}
+		examples = append(examples, diff.String())
+	}
+	return fmt.Sprintf("%s loses or alters %d field(s): %s", path, len(r.Differences), strings.Join(examples, "; "))
+}
+
+// checkRoundTrip converts data from sourceFormat to targetFormat and back,
+// then diffs the result against the original.
+func checkRoundTrip(sourceFormat, targetFormat string, data []byte) (*RoundTripReport, error) {
+	source, err := GetAdapter(sourceFormat)
+	if err != nil {
+		return nil, err
+	}
+	target, err := GetAdapter(targetFormat)
+	if err != nil {
+		return nil, err
+	}
+	original, err := source.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s data: %w", sourceFormat, err)
+	}
+
+	converted, err := convertBetween(sourceFormat, targetFormat, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s to %s conversion failed: %w", sourceFormat, targetFormat, err)
+	}
+	restored, err := convertBetween(targetFormat, sourceFormat, converted)
+	if err != nil {
+		return nil, fmt.Errorf("%s to %s conversion failed: %w", targetFormat, sourceFormat, err)
+	}
+	result, err := source.Decode(restored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode round-tripped %s data: %w", sourceFormat, err)
+	}
+
+	differences := diffSystems(original, result)
+	if differences == nil {
+		differences = []SystemDifference{}
+	}
+	return &RoundTripReport{
+		SourceFormat: source.Name(),
+		TargetFormat: target.Name(),
+		Lossless:     len(differences) == 0,
+		Differences:  differences,
+		Unmapped:     unmappedCapabilities(original, target.Name()),
+	}, nil
+}
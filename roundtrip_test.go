@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckRoundTripLossless(t *testing.T) {
+	data := []byte(`{"users": [{"account_sid": "AC1", "friendly_name": "John", "email": "john@example.com", "status": "active"}],
+		"phone_numbers": [{"sid": "PN1", "phone_number": "+15551230001", "capabilities": {"voice": true, "sms": true, "mms": false, "fax": false}}]}`)
+
+	report, err := checkRoundTrip("twilio", "ringcentral", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Lossless || len(report.Differences) != 0 || len(report.Unmapped) != 0 {
+		t.Errorf("report = %+v", report)
+	}
+	if report.SourceFormat != "Twilio" || report.TargetFormat != "RingCentral" {
+		t.Errorf("formats = %s, %s, want the registered names", report.SourceFormat, report.TargetFormat)
+	}
+	if !strings.HasSuffix(report.Summary(), "is lossless") {
+		t.Errorf("Summary = %q", report.Summary())
+	}
+}
+
+func TestCheckRoundTripSparseCapabilities(t *testing.T) {
+	// RingCentral spells out every feature it knows, Twilio only lists some
+	data := []byte(`{"phone_numbers": [{"sid": "PN1", "phone_number": "+15551230001", "capabilities": {"voice": true}}]}`)
+
+	report, err := checkRoundTrip("Twilio", "RingCentral", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Lossless {
+		t.Errorf("sparse capabilities reported as lossy: %s", report.Summary())
+	}
+}
+
+func TestCheckRoundTripReportsLosses(t *testing.T) {
+	data := []byte(`{"accounts": [{"id": "1", "name": "Jane", "active": true}],
+		"numbers": [{"id": "N1", "phone_number": "+15551230001", "features": ["voice", "voicemail"]}]}`)
+
+	report, err := checkRoundTrip("RingCentral", "Twilio", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Lossless {
+		t.Fatal("voicemail survived a trip through Twilio")
+	}
+	if want := []UnmappedCapability{{NumberID: "N1", Capability: "voicemail", TargetFormat: "Twilio"}}; !reflect.DeepEqual(report.Unmapped, want) {
+		t.Errorf("Unmapped = %+v, want %+v", report.Unmapped, want)
+	}
+	if !strings.Contains(report.Summary(), "capabilities.voicemail") {
+		t.Errorf("Summary = %q does not name the lost capability", report.Summary())
+	}
+
+	if _, err := checkRoundTrip("RingCentral", "Twilio", []byte(`{"accounts": `)); err == nil {
+		t.Error("round trip of invalid JSON succeeded")
+	}
+}
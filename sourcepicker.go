@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/filepicker"
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Lines of the source screen around the file list
+const sourcePickerChrome = 9
+
+// Rows shown by each preview table
+const previewTableHeight = 6
+
+func newSourcePicker() filepicker.Model {
+	picker := filepicker.New()
+	picker.AllowedTypes = []string{".json"}
+	picker.AutoHeight = false
+	picker.Height = 10
+	picker.ShowPermissions = false
+	if dir, err := os.Getwd(); err == nil {
+		picker.CurrentDirectory = dir
+	}
+	return picker
+}
+
+// resolveSourcePath checks a typed source path. A path without an extension
+// may leave out .json.
+func resolveSourcePath(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("enter a file name")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if filepath.Ext(path) == "" {
+		if _, err := os.Stat(path + ".json"); err == nil {
+			return path + ".json", nil
+		}
+	}
+	return "", fmt.Errorf("%s does not exist", path)
+}
+
+func (m model) updateSourcePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.typingPath {
+		switch msg.String() {
+		case "ctrl+c":
+			return m.quit()
+		case "esc":
+			m.typingPath = false
+			m.sourceErr = nil
+			return m, nil
+		case "enter":
+			path, err := resolveSourcePath(strings.TrimSpace(m.textInput.Value()))
+			if err != nil {
+				m.sourceErr = err
+				return m, nil
+			}
+			return m.openSourcePreview(path), nil
+		}
+		var cmd tea.Cmd
+		m.textInput, cmd = m.textInput.Update(msg)
+		return m, cmd
+	}
+
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m.quit()
+	case "/", "tab":
+		m.typingPath = true
+		m.sourceErr = nil
+		m.textInput.SetValue("")
+		m.textInput.Placeholder = "Enter source JSON filename..."
+		m.textInput.Focus()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.filepicker, cmd = m.filepicker.Update(msg)
+	if ok, path := m.filepicker.DidSelectFile(msg); ok {
+		return m.openSourcePreview(path), cmd
+	}
+	if ok, path := m.filepicker.DidSelectDisabledFile(msg); ok {
+		m.sourceErr = fmt.Errorf("%s is not a .json file", filepath.Base(path))
+	}
+	return m, cmd
+}
+
+// openSourcePreview reads the chosen file, detects its format and, when it
+// is recognised, parses it for the preview. Unreadable files and invalid
+// JSON keep the user on the source screen.
+func (m model) openSourcePreview(path string) model {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		m.sourceErr = fmt.Errorf("failed to read source file: %w", err)
+		return m
+	}
+	if !json.Valid(data) {
+		m.sourceErr = fmt.Errorf("%s is not valid JSON", filepath.Base(path))
+		return m
+	}
+
+	m.config.SourceFile = path
+	m.sourceErr = nil
+	m.preview = nil
+	m.previewReport = nil
+	m.detectedFormat, m.detectErr = DetectFormat(data)
+	if m.detectErr == nil {
+		adapter, _ := GetAdapter(m.detectedFormat)
+		if m.preview, err = adapter.Decode(data); err != nil {
+			m.detectErr = fmt.Errorf("looks like %s but does not parse: %w", m.detectedFormat, err)
+			m.preview = nil
+		} else {
+			m.previewReport, _ = ValidateSource(m.detectedFormat, data)
+		}
+		for i, format := range m.sourceFormats {
+			if format == m.detectedFormat {
+				m.selectedSource = i
+			}
+		}
+	}
+
+	m.userTable, m.numberTable = previewTables(m.preview)
+	m.state = previewingSource
+	return m
+}
+
+// previewTables lists the parsed users and numbers. The user table starts
+// with the focus.
+func previewTables(system *CanonicalPhoneSystem) (table.Model, table.Model) {
+	var userRows, numberRows []table.Row
+	if system != nil {
+		for _, user := range system.Users {
+			userRows = append(userRows, table.Row{user.ID, user.Name, user.Email, user.PhoneNumber, user.Status})
+		}
+		for _, number := range system.Numbers {
+			numberRows = append(numberRows, table.Row{number.ID, number.Number, strings.Join(enabledCapabilities(number), ", "), number.Location})
+		}
+	}
+
+	users := table.New(
+		table.WithColumns([]table.Column{
+			{Title: "ID", Width: 20},
+			{Title: "Name", Width: 18},
+			{Title: "Email", Width: 28},
+			{Title: "Phone", Width: 14},
+			{Title: "Status", Width: 9},
+		}),
+		table.WithRows(userRows),
+		table.WithHeight(previewTableHeight),
+		table.WithFocused(true),
+	)
+	numbers := table.New(
+		table.WithColumns([]table.Column{
+			{Title: "ID", Width: 20},
+			{Title: "Number", Width: 14},
+			{Title: "Capabilities", Width: 28},
+			{Title: "Location", Width: 16},
+		}),
+		table.WithRows(numberRows),
+		table.WithHeight(previewTableHeight),
+	)
+	return users, numbers
+}
+
+func (m model) updateSourcePreview(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m.quit()
+	case "esc":
+		// Pick another file
+		m.state = enteringSource
+		return m, nil
+	case "enter":
+		m.state = selectingSourceFormat
+		return m, nil
+	case "tab":
+		if m.userTable.Focused() {
+			m.userTable.Blur()
+			m.numberTable.Focus()
+		} else {
+			m.numberTable.Blur()
+			m.userTable.Focus()
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	if m.userTable.Focused() {
+		m.userTable, cmd = m.userTable.Update(msg)
+	} else {
+		m.numberTable, cmd = m.numberTable.Update(msg)
+	}
+	return m, cmd
+}
+
+func (m model) sourcePickerView() string {
+	var s strings.Builder
+
+	s.WriteString(subtitleStyle.Render("Step 1: Choose the source JSON export"))
+	s.WriteString("\n\n")
+	if m.typingPath {
+		s.WriteString("Source filename:\n")
+		s.WriteString(m.textInput.View())
+		s.WriteString("\n\n")
+	} else {
+		s.WriteString(fmt.Sprintf("%s\n\n", m.filepicker.CurrentDirectory))
+		s.WriteString(m.filepicker.View())
+		s.WriteString("\n")
+	}
+	if m.sourceErr != nil {
+		s.WriteString(errorStyle.Render(fmt.Sprintf("⚠ %v", m.sourceErr)))
+		s.WriteString("\n\n")
+	}
+	if m.typingPath {
+		s.WriteString(helpStyle.Render("Type a path and press Enter, Esc to browse instead"))
+	} else {
+		s.WriteString(helpStyle.Render("↑/↓ select • Enter open • ←/h parent folder • / type a path • q quit"))
+	}
+	return s.String()
+}
+
+func (m model) sourcePreviewView() string {
+	var s strings.Builder
+
+	s.WriteString(subtitleStyle.Render("Step 1: Preview the source data"))
+	s.WriteString("\n\n")
+	s.WriteString(fmt.Sprintf("Source file: %s\n", m.config.SourceFile))
+	if m.detectErr != nil {
+		s.WriteString(errorStyle.Render(fmt.Sprintf("⚠ Format not detected: %v", m.detectErr)))
+		s.WriteString("\n")
+		s.WriteString("Choose the format on the next screen.\n\n")
+		s.WriteString(helpStyle.Render("Enter to continue, Esc to pick another file"))
+		return s.String()
+	}
+
+	s.WriteString(successStyle.Render(fmt.Sprintf("Detected format: %s", m.detectedFormat)))
+	s.WriteString("\n")
+	if report := m.previewReport; report != nil {
+		if report.HasErrors() {
+			s.WriteString(errorStyle.Render("⚠ Validation: " + report.Summary()))
+		} else {
+			s.WriteString("Validation: " + report.Summary())
+		}
+		s.WriteString("\n")
+	}
+	s.WriteString("\n")
+
+	s.WriteString(subtitleStyle.Render(fmt.Sprintf("👥 Users (%d)", len(m.preview.Users))))
+	s.WriteString("\n")
+	s.WriteString(m.userTable.View())
+	s.WriteString("\n\n")
+	s.WriteString(subtitleStyle.Render(fmt.Sprintf("📞 Numbers (%d)", len(m.preview.Numbers))))
+	s.WriteString("\n")
+	s.WriteString(m.numberTable.View())
+	s.WriteString("\n\n")
+	s.WriteString(helpStyle.Render("↑/↓ scroll • Tab switch table • Enter continue • Esc pick another file"))
+	return s.String()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSourcePath(t *testing.T) {
+	dir := t.TempDir()
+	export := filepath.Join(dir, "export.json")
+	if err := os.WriteFile(export, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := resolveSourcePath(export); err != nil || got != export {
+		t.Errorf("resolveSourcePath(full path) = %q, %v", got, err)
+	}
+	if got, err := resolveSourcePath(filepath.Join(dir, "export")); err != nil || got != export {
+		t.Errorf("resolveSourcePath(without .json) = %q, %v", got, err)
+	}
+	if _, err := resolveSourcePath(filepath.Join(dir, "missing")); err == nil {
+		t.Error("resolveSourcePath accepted a missing file")
+	}
+	if _, err := resolveSourcePath(""); err == nil {
+		t.Error("resolveSourcePath accepted an empty name")
+	}
+}
+
+func TestOpenSourcePreview(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	m := initialModel().openSourcePreview(write("rc.json", `{
+		"accounts": [{"id": "1", "name": "Jane Smith", "contact": "jane@example.com", "active": true}],
+		"numbers": [{"id": "N1", "phone_number": "+15559876543", "features": ["voice"]}]
+	}`))
+	if m.state != previewingSource || m.detectedFormat != "RingCentral" {
+		t.Fatalf("state %v, detected %q", m.state, m.detectedFormat)
+	}
+	if m.sourceFormats[m.selectedSource] != "RingCentral" {
+		t.Errorf("selected source format %q", m.sourceFormats[m.selectedSource])
+	}
+	if len(m.userTable.Rows()) != 1 || len(m.numberTable.Rows()) != 1 {
+		t.Errorf("preview has %d users and %d numbers", len(m.userTable.Rows()), len(m.numberTable.Rows()))
+	}
+
+	// An unrecognised shape is still previewed, with the format left to the user
+	m = initialModel().openSourcePreview(write("other.json", `{"lines": []}`))
+	if m.state != previewingSource || m.detectErr == nil || m.preview != nil {
+		t.Errorf("unrecognised export: state %v, detect error %v", m.state, m.detectErr)
+	}
+
+	// Invalid JSON keeps the user on the source screen
+	start := initialModel()
+	m = start.openSourcePreview(write("broken.json", `{"users": `))
+	if m.state != start.state || m.sourceErr == nil {
+		t.Errorf("invalid JSON: state %v, error %v", m.state, m.sourceErr)
+	}
+}
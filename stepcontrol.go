@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// SkippedStep records a step the user chose to skip, and why.
+type SkippedStep struct {
+	Step          int    `json:"step"`
+	Description   string `json:"description"`
+	Justification string `json:"justification"`
+	Error         string `json:"error,omitempty"` // empty when skipped at the approval gate
+}
+
+// A file written by a run, with what it replaced so it can be rolled back
+type writtenFile struct {
+	Path     string `json:"path"`
+	Previous []byte `json:"previous,omitempty"`
+	Existed  bool   `json:"existed"`
+}
+
+// writeFile writes path, remembering its previous contents for rollback.
+func (r *migrationRun) writeFile(path string, data []byte) error {
+	previous, err := ioutil.ReadFile(path)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s before overwriting it: %w", path, err)
+	}
+	r.written = append(r.written, writtenFile{Path: path, Previous: previous, Existed: existed})
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// rollback restores every file the run wrote, newest first, and describes
+// what it did. The source backup is kept.
+func (r *migrationRun) rollback() ([]string, error) {
+	var done []string
+	for i := len(r.written) - 1; i >= 0; i-- {
+		file := r.written[i]
+		if file.Existed {
+			if err := ioutil.WriteFile(file.Path, file.Previous, 0644); err != nil {
+				return done, fmt.Errorf("failed to restore %s: %w", file.Path, err)
+			}
+			done = append(done, fmt.Sprintf("Restored the previous %s", file.Path))
+			continue
+		}
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			return done, fmt.Errorf("failed to remove %s: %w", file.Path, err)
+		}
+		done = append(done, fmt.Sprintf("Removed %s", file.Path))
+	}
+	r.written = nil
+	if r.backupFile != "" {
+		done = append(done, fmt.Sprintf("Kept the source backup %s", r.backupFile))
+	}
+	return done, nil
+}
+
+// needsApproval reports whether step waits for approval before it runs.
+func (m model) needsApproval(step ExecutionStep) bool {
+	return m.config.ApproveHighRisk && step.Risk == "high" && !step.Approved && step.Executor != executorManual
+}
+
+// canSkip reports whether step may be skipped. Without the write step the
+// run would complete with no output.
+func canSkip(step ExecutionStep) bool {
+	return step.Executor != executorWrite
+}
+
+// updateStepControl handles the keys of a step that failed or waits for
+// approval. It reports false for other keys.
+func (m model) updateStepControl(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
+	if m.currentStep >= len(m.executionSteps) {
+		return m, nil, false
+	}
+	step := &m.executionSteps[m.currentStep]
+	if step.Status != "failed" && step.Status != "approval" {
+		return m, nil, false
+	}
+
+	if m.skipping {
+		switch msg.String() {
+		case "ctrl+c":
+			model, cmd := m.quit()
+			return model, cmd, true
+		case "esc":
+			m.skipping = false
+			return m, nil, true
+		case "enter":
+			justification := strings.TrimSpace(m.textInput.Value())
+			if justification == "" {
+				return m, nil, true
+			}
+			m.skipping = false
+			m.run.skipped = append(m.run.skipped, SkippedStep{
+				Step:          step.StepNumber,
+				Description:   step.Description,
+				Justification: justification,
+				Error:         errorText(step.Error),
+			})
+			step.Status = "skipped"
+			step.Justification = justification
+			m.currentStep++
+			model, cmd := m.startCurrentStep()
+			return model, cmd, true
+		}
+		var cmd tea.Cmd
+		m.textInput, cmd = m.textInput.Update(msg)
+		return m, cmd, true
+	}
+
+	switch msg.String() {
+	case "r", "R":
+		if step.Status != "failed" {
+			return m, nil, false
+		}
+		step.Status = "pending"
+		step.Error = nil
+		step.Details = ""
+		// The source file may have been fixed since
+		m.run.forgetSource()
+		model, cmd := m.startCurrentStep()
+		return model, cmd, true
+	case "y", "Y", "enter":
+		if step.Status != "approval" {
+			return m, nil, false
+		}
+		step.Approved = true
+		model, cmd := m.startCurrentStep()
+		return model, cmd, true
+	case "s", "S":
+		if !canSkip(*step) {
+			return m, nil, true
+		}
+		m.skipping = true
+		m.textInput.SetValue("")
+		m.textInput.Placeholder = "Why is it safe to skip this step?"
+		m.textInput.Focus()
+		return m, nil, true
+	case "x", "X":
+		return m.abortRun(), nil, true
+	}
+	return m, nil, false
+}
+
+// abortRun rolls back what the run wrote and shows the recovery screen.
+func (m model) abortRun() model {
+	step := m.executionSteps[m.currentStep]
+	reason := "aborted before it ran"
+	if step.Error != nil {
+		reason = step.Error.Error()
+	}
+	rolledBack, err := m.run.rollback()
+	m.rolledBack = rolledBack
+	// Nothing is left to resume
+	m = m.removeCheckpoint()
+	if err != nil {
+		return m.fail(stepFailed, fmt.Errorf("migration aborted at step %d (%s), and rollback failed: %w", step.StepNumber, reason, err))
+	}
+	return m.fail(stepFailed, fmt.Errorf("migration aborted at step %d: %s", step.StepNumber, reason))
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// stepControlView is the prompt below the step list while a step failed or
+// waits for approval.
+func (m model) stepControlView() string {
+	if m.currentStep >= len(m.executionSteps) {
+		return ""
+	}
+	step := m.executionSteps[m.currentStep]
+	if m.skipping {
+		return fmt.Sprintf("Skip step %d: %s\n", step.StepNumber, step.Description) +
+			m.textInput.View() + "\n" +
+			helpStyle.Render("Enter to skip with this justification, Esc to go back") + "\n"
+	}
+	skip := ", s to skip"
+	if !canSkip(step) {
+		skip = ""
+	}
+	switch step.Status {
+	case "failed":
+		return errorStyle.Render(fmt.Sprintf("Step %d failed. r to retry%s, x to abort and roll back", step.StepNumber, skip)) + "\n"
+	case "approval":
+		return aiStyle.Render(fmt.Sprintf("Step %d is high risk. Run it? (Y to approve%s, x to abort and roll back)", step.StepNumber, skip)) + "\n"
+	}
+	return ""
+}
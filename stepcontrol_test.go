@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func typeKey(t *testing.T, m model, key string) model {
+	t.Helper()
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)})
+	return updated.(model)
+}
+
+// failedStepModel is a run whose second step just failed.
+func failedStepModel(t *testing.T) model {
+	t.Helper()
+	m := initialModel()
+	m.state = executingPlan
+	m.run = newTestRun(t, "RingCentral")
+	m.executionSteps = []ExecutionStep{
+		{StepNumber: 1, Description: "Back up", Executor: executorBackup, Status: "completed"},
+		{StepNumber: 2, Description: "Validate", Executor: executorValidate, Status: "running"},
+		{StepNumber: 3, Description: "Tell the users", Executor: executorManual, Status: "pending"},
+	}
+	m.currentStep = 1
+
+	updated, _ := m.Update(stepCompleteMsg{stepNumber: 2, err: errors.New("3 problems found")})
+	return updated.(model)
+}
+
+func TestFailedStepWaitsForRetry(t *testing.T) {
+	m := failedStepModel(t)
+	if m.state != executingPlan || m.executionSteps[1].Status != "failed" {
+		t.Fatalf("after a failure: state %v, step status %q", m.state, m.executionSteps[1].Status)
+	}
+
+	m = typeKey(t, m, "r")
+	step := m.executionSteps[1]
+	if step.Status != "running" || step.Error != nil || m.currentStep != 1 {
+		t.Errorf("retry: step %d status %q, error %v", m.currentStep, step.Status, step.Error)
+	}
+}
+
+func TestSkipFailedStepNeedsJustification(t *testing.T) {
+	m := failedStepModel(t)
+
+	m = typeKey(t, m, "s")
+	if !m.skipping {
+		t.Fatal("s did not ask for a justification")
+	}
+	m = sendKey(t, m, tea.KeyEnter)
+	if !m.skipping || m.executionSteps[1].Status != "failed" {
+		t.Fatal("skipped without a justification")
+	}
+
+	m.textInput.SetValue("validated by hand")
+	m = sendKey(t, m, tea.KeyEnter)
+	if m.skipping || m.executionSteps[1].Status != "skipped" || m.currentStep != 2 {
+		t.Fatalf("step status %q, current step %d", m.executionSteps[1].Status, m.currentStep)
+	}
+	want := SkippedStep{Step: 2, Description: "Validate", Justification: "validated by hand", Error: "3 problems found"}
+	if len(m.run.skipped) != 1 || m.run.skipped[0] != want {
+		t.Errorf("skipped = %+v, want %+v", m.run.skipped, want)
+	}
+}
+
+func TestHighRiskStepWaitsForApproval(t *testing.T) {
+	m := initialModel()
+	m.state = executingPlan
+	m.config.ApproveHighRisk = true
+	m.run = newTestRun(t, "RingCentral")
+	m.executionSteps = []ExecutionStep{
+		{StepNumber: 1, Description: "Write the target", Executor: executorWrite, Risk: "high", Status: "pending"},
+	}
+
+	m, _ = m.startCurrentStep()
+	if m.executionSteps[0].Status != "approval" {
+		t.Fatalf("high-risk step status %q", m.executionSteps[0].Status)
+	}
+	if _, _, handled := m.updateStepControl(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")}); handled {
+		t.Error("r retried a step that has not run")
+	}
+
+	// Skipping the write step would complete the run with no output
+	m = typeKey(t, m, "s")
+	if m.skipping || strings.Contains(m.stepControlView(), "s to skip") {
+		t.Error("offered to skip the write step")
+	}
+
+	m = typeKey(t, m, "y")
+	if step := m.executionSteps[0]; !step.Approved || step.Status != "running" {
+		t.Errorf("approved step: approved %t, status %q", step.Approved, step.Status)
+	}
+}
+
+func TestMigrationRunRollback(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.json")
+	created := filepath.Join(dir, "created.json")
+	if err := ioutil.WriteFile(existing, []byte("before"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := &migrationRun{backupFile: "source.backup.json"}
+	for _, path := range []string{existing, created, existing} {
+		if err := run.writeFile(path, []byte("after")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done, err := run.rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(existing); string(data) != "before" {
+		t.Errorf("%s holds %q after rollback", existing, data)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("%s still exists after rollback", created)
+	}
+	if len(done) != 4 || done[3] != "Kept the source backup source.backup.json" {
+		t.Errorf("rollback reported %q", done)
+	}
+}
+
+func TestRetryReadsFixedSource(t *testing.T) {
+	m := failedStepModel(t)
+	fixed, err := ioutil.ReadFile(m.run.config.SourceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The failed validation saw an empty export, which is then fixed on disk
+	if err := ioutil.WriteFile(m.run.config.SourceFile, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.run.loadSource(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(m.run.config.SourceFile, fixed, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = updated.(model)
+	if cmd == nil {
+		t.Fatal("retry did not run the step")
+	}
+	if msg, ok := cmd().(stepCompleteMsg); !ok || msg.err != nil {
+		t.Errorf("retried step = %+v", msg)
+	}
+	if len(m.run.source.Users) == 0 {
+		t.Error("retry used the source as it was before the fix")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Price of a model in US dollars per million tokens
+type ModelPrice struct {
+	Model         string  `json:"model"`
+	InputPerMTok  float64 `json:"input_per_mtok"`
+	OutputPerMTok float64 `json:"output_per_mtok"`
+}
+
+var defaultModelPrices = []ModelPrice{
+	{Model: "claude-3-opus", InputPerMTok: 15, OutputPerMTok: 75},
+	{Model: "claude-3-sonnet", InputPerMTok: 3, OutputPerMTok: 15},
+	{Model: "claude-3-5-sonnet", InputPerMTok: 3, OutputPerMTok: 15},
+	{Model: "claude-3-haiku", InputPerMTok: 0.25, OutputPerMTok: 1.25},
+	{Model: "gpt-4o", InputPerMTok: 2.5, OutputPerMTok: 10},
+	{Model: "gpt-4o-mini", InputPerMTok: 0.15, OutputPerMTok: 0.6},
+}
+
+// Price table used for cost estimates, replaced by LoadModelPrices
+var modelPrices = defaultModelPrices
+
+// Environment variable pointing at a JSON price table
+const modelPricesEnv = "ENGINE_ROOM_PRICES"
+
+// LoadModelPrices replaces the price table with the JSON array of ModelPrice
+// entries in path.
+func LoadModelPrices(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read price table: %w", err)
+	}
+
+	var prices []ModelPrice
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return fmt.Errorf("failed to parse price table: %w", err)
+	}
+	for _, price := range prices {
+		if price.Model == "" {
+			return fmt.Errorf("price table entry has no model name")
+		}
+		if price.InputPerMTok < 0 || price.OutputPerMTok < 0 {
+			return fmt.Errorf("price table entry for %s has a negative price", price.Model)
+		}
+	}
+
+	modelPrices = prices
+	return nil
+}
+
+func loadModelPricesFromEnv() error {
+	if path := os.Getenv(modelPricesEnv); path != "" {
+		return LoadModelPrices(path)
+	}
+	return nil
+}
+
+// priceFor finds the price of a model. Dated model names such as
+// claude-3-sonnet-20240229 match their family by the longest prefix.
+func priceFor(model string) (ModelPrice, bool) {
+	var best ModelPrice
+	found := false
+	for _, price := range modelPrices {
+		if model == price.Model {
+			return price, true
+		}
+		if strings.HasPrefix(model, price.Model+"-") && len(price.Model) > len(best.Model) {
+			best, found = price, true
+		}
+	}
+	return best, found
+}
+
+func (p ModelPrice) cost(usage EngineRoomUsage) float64 {
+	return (float64(usage.InputTokens)*p.InputPerMTok + float64(usage.OutputTokens)*p.OutputPerMTok) / 1e6
+}
+
+// formatUSD rounds to a millionth of a dollar, since single calls often
+// cost less than a cent.
+func formatUSD(amount float64) string {
+	return "$" + strconv.FormatFloat(math.Round(amount*1e6)/1e6, 'f', -1, 64)
+}
+
+// Token usage and estimated cost of one Engine Room AI call
+type CallUsage struct {
+	Model         string  `json:"model"`
+	InputTokens   int     `json:"input_tokens"`
+	OutputTokens  int     `json:"output_tokens"`
+	EstimatedCost float64 `json:"estimated_cost_usd"`
+	Priced        bool    `json:"priced"` // false when the model is not in the price table
+}
+
+// Totals for every Engine Room AI call of one migration
+type UsageSummary struct {
+	Calls         []CallUsage `json:"calls"`
+	InputTokens   int         `json:"input_tokens"`
+	OutputTokens  int         `json:"output_tokens"`
+	EstimatedCost float64     `json:"estimated_cost_usd"`
+	Budget        float64     `json:"budget_usd,omitempty"`
+}
+
+// String is a one-line description for the completed screen.
+func (s *UsageSummary) String() string {
+	text := fmt.Sprintf("%d call(s), %d input + %d output tokens, ~%s",
+		len(s.Calls), s.InputTokens, s.OutputTokens, formatUSD(s.EstimatedCost))
+	if s.Budget > 0 {
+		text += fmt.Sprintf(" of %s budget", formatUSD(s.Budget))
+	}
+	for _, call := range s.Calls {
+		if !call.Priced {
+			text += " (some models have no price, cost is a lower bound)"
+			break
+		}
+	}
+	return text
+}
+
+// meteredProvider counts the tokens used by the wrapped provider and refuses
+// to call it once the budget is spent.
+type meteredProvider struct {
+	inner  LLMProvider
+	model  string
+	budget float64 // US dollars, zero for no limit
+
+	mu    sync.Mutex
+	calls []CallUsage
+}
+
+func (p *meteredProvider) Name() string { return p.inner.Name() }
+
+func (p *meteredProvider) Complete(ctx context.Context, messages []EngineRoomMessage) (*LLMResponse, error) {
+	if err := p.checkBudget(messages); err != nil {
+		return nil, err
+	}
+
+	response, err := p.inner.Complete(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	call := CallUsage{
+		Model:        p.model,
+		InputTokens:  response.Usage.InputTokens,
+		OutputTokens: response.Usage.OutputTokens,
+	}
+	if response.Model != "" {
+		call.Model = response.Model
+	}
+	if price, ok := priceFor(call.Model); ok {
+		call.EstimatedCost = price.cost(response.Usage)
+		call.Priced = true
+	}
+
+	p.mu.Lock()
+	p.calls = append(p.calls, call)
+	p.mu.Unlock()
+	return response, nil
+}
+
+// checkBudget refuses a call when the budget is already spent or when the
+// prompt alone, at roughly four characters per token, would exceed it.
+func (p *meteredProvider) checkBudget(messages []EngineRoomMessage) error {
+	if p.budget <= 0 {
+		return nil
+	}
+	spent := p.Usage().EstimatedCost
+	if spent >= p.budget {
+		return fmt.Errorf("Engine Room AI budget of %s exhausted (%s spent)", formatUSD(p.budget), formatUSD(spent))
+	}
+
+	price, ok := priceFor(p.model)
+	if !ok {
+		return nil
+	}
+	chars := 0
+	for _, message := range messages {
+		chars += len(message.Content)
+	}
+	estimate := price.cost(EngineRoomUsage{InputTokens: chars / 4})
+	if spent+estimate > p.budget {
+		return fmt.Errorf("Engine Room AI budget of %s would be exceeded: %s spent, this request needs about %s", formatUSD(p.budget), formatUSD(spent), formatUSD(estimate))
+	}
+	return nil
+}
+
+// Usage returns the totals so far.
+func (p *meteredProvider) Usage() *UsageSummary {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	summary := &UsageSummary{Calls: append([]CallUsage{}, p.calls...), Budget: p.budget}
+	for _, call := range p.calls {
+		summary.InputTokens += call.InputTokens
+		summary.OutputTokens += call.OutputTokens
+		summary.EstimatedCost += call.EstimatedCost
+	}
+	return summary
+}
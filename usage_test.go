@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// usageProvider replies with fixed token counts for the given model.
+type usageProvider struct {
+	model string
+	usage EngineRoomUsage
+	calls int
+}
+
+func (p *usageProvider) Name() string { return "usage" }
+
+func (p *usageProvider) Complete(ctx context.Context, messages []EngineRoomMessage) (*LLMResponse, error) {
+	p.calls++
+	return &LLMResponse{Text: "ok", Model: p.model, Usage: p.usage}, nil
+}
+
+func TestPriceFor(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+		ok    bool
+	}{
+		{"claude-3-sonnet-20240229", "claude-3-sonnet", true},
+		{"claude-3-5-sonnet-20241022", "claude-3-5-sonnet", true},
+		{"gpt-4o-mini", "gpt-4o-mini", true},
+		{"gpt-4o-2024-08-06", "gpt-4o", true},
+		{"gpt-4-turbo", "", false},
+		{"llama3", "", false},
+	}
+	for _, tt := range tests {
+		price, ok := priceFor(tt.model)
+		if ok != tt.ok || price.Model != tt.want {
+			t.Errorf("priceFor(%q) = %q, %t, want %q, %t", tt.model, price.Model, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMeteredProviderBudget(t *testing.T) {
+	// 100k input and 10k output tokens of claude-3-sonnet cost $0.45
+	inner := &usageProvider{model: "claude-3-sonnet-20240229", usage: EngineRoomUsage{InputTokens: 100000, OutputTokens: 10000}}
+	metered := &meteredProvider{inner: inner, model: "claude-3-sonnet-20240229", budget: 1}
+	question := []EngineRoomMessage{{Role: "user", Content: "plan"}}
+
+	for i := 0; i < 3; i++ {
+		if _, err := metered.Complete(context.Background(), question); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	// $1.35 is spent now, so the fourth call never reaches the provider
+	if _, err := metered.Complete(context.Background(), question); err == nil || !strings.Contains(err.Error(), "exhausted") {
+		t.Fatalf("error = %v, want the budget to be exhausted", err)
+	}
+	if inner.calls != 3 {
+		t.Errorf("provider was called %d times, want 3", inner.calls)
+	}
+
+	usage := metered.Usage()
+	if len(usage.Calls) != 3 || usage.InputTokens != 300000 || formatUSD(usage.EstimatedCost) != "$1.35" {
+		t.Errorf("usage = %s", usage)
+	}
+}
+
+func TestMeteredProviderRefusesLargePrompt(t *testing.T) {
+	inner := &usageProvider{model: "claude-3-opus"}
+	metered := &meteredProvider{inner: inner, model: "claude-3-opus", budget: 0.01}
+
+	// About 1000 tokens of opus input is $0.015
+	large := []EngineRoomMessage{{Role: "user", Content: strings.Repeat("x", 4000)}}
+	if _, err := metered.Complete(context.Background(), large); err == nil || !strings.Contains(err.Error(), "would be exceeded") {
+		t.Errorf("error = %v, want a pre-flight refusal", err)
+	}
+	if inner.calls != 0 {
+		t.Error("oversized prompt reached the provider")
+	}
+}
+
+func TestUsageSummaryUnpricedModel(t *testing.T) {
+	inner := &usageProvider{model: "llama3", usage: EngineRoomUsage{InputTokens: 50, OutputTokens: 5}}
+	metered := &meteredProvider{inner: inner, model: "llama3", budget: 0.5}
+	if _, err := metered.Complete(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	usage := metered.Usage()
+	if usage.Calls[0].Priced || usage.EstimatedCost != 0 {
+		t.Errorf("unknown model was priced: %+v", usage.Calls[0])
+	}
+	want := "1 call(s), 50 input + 5 output tokens, ~$0 of $0.5 budget (some models have no price, cost is a lower bound)"
+	if got := usage.String(); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Finding severities, from blocking to informational
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityInfo    = "info"
+)
+
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+type ValidationFinding struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Kind     string `json:"kind"` // "user" or "number"
+	ID       string `json:"id"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+type ValidationReport struct {
+	Format   string              `json:"format"`
+	Users    int                 `json:"users"`
+	Numbers  int                 `json:"numbers"`
+	Errors   int                 `json:"errors"`
+	Warnings int                 `json:"warnings"`
+	Findings []ValidationFinding `json:"findings"`
+}
+
+// HasErrors reports whether any finding should block the migration.
+func (r *ValidationReport) HasErrors() bool {
+	return r.Errors > 0
+}
+
+// Summary is a one-line description of the report for step details and logs.
+func (r *ValidationReport) Summary() string {
+	return fmt.Sprintf("%d users, %d numbers: %d error(s), %d warning(s), %d finding(s) total",
+		r.Users, r.Numbers, r.Errors, r.Warnings, len(r.Findings))
+}
+
+// FindingsFor returns the findings recorded against one user or number.
+func (r *ValidationReport) FindingsFor(kind, id string) []ValidationFinding {
+	var findings []ValidationFinding
+	for _, finding := range r.Findings {
+		if finding.Kind == kind && finding.ID == id {
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+func (r *ValidationReport) add(severity, code, kind, id, field, message string) {
+	r.Findings = append(r.Findings, ValidationFinding{
+		Severity: severity,
+		Code:     code,
+		Kind:     kind,
+		ID:       id,
+		Field:    field,
+		Message:  message,
+	})
+	switch severity {
+	case severityError:
+		r.Errors++
+	case severityWarning:
+		r.Warnings++
+	}
+}
+
+// FormatValidator is implemented by adapters that have checks beyond the
+// canonical ones, such as values the canonical model cannot represent.
+type FormatValidator interface {
+	ValidateRaw(data []byte, report *ValidationReport) error
+}
+
+// ValidateSource decodes data with the named adapter and validates it.
+func ValidateSource(format string, data []byte) (*ValidationReport, error) {
+	adapter, err := GetAdapter(format)
+	if err != nil {
+		return nil, err
+	}
+	system, err := adapter.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s data: %w", format, err)
+	}
+
+	report := validateCanonical(adapter.Name(), system)
+	if validator, ok := adapter.(FormatValidator); ok {
+		if err := validator.ValidateRaw(data, report); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+func (TwilioAdapter) ValidateRaw(data []byte, report *ValidationReport) error {
+	var twilioSystem TwilioPhoneSystem
+	if err := json.Unmarshal(data, &twilioSystem); err != nil {
+		return err
+	}
+	validateTwilioStatuses(twilioSystem, report)
+	return nil
+}
+
+// Statuses other than active/inactive collapse into RingCentral's Active flag
+func validateTwilioStatuses(twilioSystem TwilioPhoneSystem, report *ValidationReport) {
+	for _, user := range twilioSystem.Users {
+		if user.Status != "active" && user.Status != "inactive" {
+			report.add(severityWarning, "unknown_status", "user", user.ID, "status",
+				fmt.Sprintf("status %q is neither active nor inactive and will be treated as inactive", user.Status))
+		}
+	}
+}
+
+func validateCanonical(format string, system *CanonicalPhoneSystem) *ValidationReport {
+	report := &ValidationReport{
+		Format:   format,
+		Users:    len(system.Users),
+		Numbers:  len(system.Numbers),
+		Findings: []ValidationFinding{},
+	}
+
+	inventory := make(map[string]bool)
+	for _, number := range system.Numbers {
+		inventory[number.Number] = true
+	}
+	assigned := make(map[string]bool)
+
+	userIDs := make(map[string]int)
+	emails := make(map[string][]string)
+	phones := make(map[string][]string)
+
+	for _, user := range system.Users {
+		if user.ID == "" {
+			report.add(severityError, "missing_id", "user", user.ID, "id", fmt.Sprintf("user %q has no ID", user.Name))
+		} else {
+			userIDs[user.ID]++
+		}
+
+		if strings.TrimSpace(user.Name) == "" {
+			report.add(severityWarning, "missing_name", "user", user.ID, "name", "user has no name")
+		}
+
+		switch {
+		case user.Email == "":
+			report.add(severityWarning, "missing_email", "user", user.ID, "email", "user has no email address")
+		case !validEmail(user.Email):
+			report.add(severityError, "invalid_email", "user", user.ID, "email", fmt.Sprintf("%q is not a valid email address", user.Email))
+		default:
+			key := strings.ToLower(user.Email)
+			emails[key] = append(emails[key], user.ID)
+		}
+
+		switch {
+		case user.PhoneNumber == "":
+			report.add(severityWarning, "missing_phone_number", "user", user.ID, "phone_number", "user has no phone number")
+		case !e164Pattern.MatchString(user.PhoneNumber):
+			report.add(severityError, "invalid_e164", "user", user.ID, "phone_number", fmt.Sprintf("%q is not in E.164 format", user.PhoneNumber))
+		default:
+			phones[user.PhoneNumber] = append(phones[user.PhoneNumber], user.ID)
+			assigned[user.PhoneNumber] = true
+			if !inventory[user.PhoneNumber] {
+				report.add(severityWarning, "no_matching_number", "user", user.ID, "phone_number",
+					fmt.Sprintf("%s is not in the phone number inventory", user.PhoneNumber))
+			}
+		}
+	}
+
+	for _, id := range sortedKeys(userIDs) {
+		if userIDs[id] > 1 {
+			report.add(severityError, "duplicate_id", "user", id, "id", fmt.Sprintf("user ID appears %d times", userIDs[id]))
+		}
+	}
+	for _, email := range sortedKeys(emails) {
+		if ids := emails[email]; len(ids) > 1 {
+			report.add(severityWarning, "duplicate_email", "user", ids[0], "email",
+				fmt.Sprintf("%s is shared by users %s", email, strings.Join(ids, ", ")))
+		}
+	}
+	for _, phone := range sortedKeys(phones) {
+		if ids := phones[phone]; len(ids) > 1 {
+			report.add(severityWarning, "duplicate_phone_number", "user", ids[0], "phone_number",
+				fmt.Sprintf("%s is shared by users %s", phone, strings.Join(ids, ", ")))
+		}
+	}
+
+	numberIDs := make(map[string]int)
+	numberValues := make(map[string][]string)
+	for _, number := range system.Numbers {
+		if number.ID == "" {
+			report.add(severityError, "missing_id", "number", number.ID, "id", fmt.Sprintf("number %s has no ID", number.Number))
+		} else {
+			numberIDs[number.ID]++
+		}
+
+		if !e164Pattern.MatchString(number.Number) {
+			report.add(severityError, "invalid_e164", "number", number.ID, "phone_number", fmt.Sprintf("%q is not in E.164 format", number.Number))
+			continue
+		}
+		numberValues[number.Number] = append(numberValues[number.Number], number.ID)
+
+		if !assigned[number.Number] {
+			report.add(severityWarning, "orphan_number", "number", number.ID, "phone_number",
+				fmt.Sprintf("%s is not assigned to any user", number.Number))
+		}
+		if len(enabledCapabilities(number)) == 0 {
+			report.add(severityInfo, "no_capabilities", "number", number.ID, "capabilities", "number has no enabled capabilities")
+		}
+	}
+
+	for _, id := range sortedKeys(numberIDs) {
+		if numberIDs[id] > 1 {
+			report.add(severityError, "duplicate_id", "number", id, "id", fmt.Sprintf("number ID appears %d times", numberIDs[id]))
+		}
+	}
+	for _, value := range sortedKeys(numberValues) {
+		if ids := numberValues[value]; len(ids) > 1 {
+			report.add(severityError, "duplicate_phone_number", "number", ids[0], "phone_number",
+				fmt.Sprintf("%s is listed by numbers %s", value, strings.Join(ids, ", ")))
+		}
+	}
+
+	return report
+}
+
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email && address.Name == ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A user with a matching number, which validates without findings
+func validUser(id, phone string) CanonicalUser {
+	return CanonicalUser{ID: id, Name: "User " + id, Email: id + "@example.com", PhoneNumber: phone, Status: "active"}
+}
+
+func validNumber(id, phone string) CanonicalNumber {
+	return CanonicalNumber{ID: id, Number: phone, Capabilities: map[string]bool{"voice": true}}
+}
+
+func TestValidateCanonical(t *testing.T) {
+	tests := []struct {
+		name   string
+		system CanonicalPhoneSystem
+		want   []string // severity code kind id, in report order
+	}{
+		{
+			name: "clean",
+			system: CanonicalPhoneSystem{
+				Users:   []CanonicalUser{validUser("u1", "+15551230001")},
+				Numbers: []CanonicalNumber{validNumber("n1", "+15551230001")},
+			},
+			want: nil,
+		},
+		{
+			name: "invalid user fields",
+			system: CanonicalPhoneSystem{
+				Users: []CanonicalUser{
+					{ID: "", Name: "No ID", Email: "noid@example.com"},
+					{ID: "u2", Name: " ", Email: "John Doe <john@example.com>", PhoneNumber: "555-1234"},
+				},
+			},
+			want: []string{
+				"error missing_id user ",
+				"warning missing_phone_number user ",
+				"warning missing_name user u2",
+				"error invalid_email user u2",
+				"error invalid_e164 user u2",
+			},
+		},
+		{
+			name: "duplicates",
+			system: CanonicalPhoneSystem{
+				Users: []CanonicalUser{
+					validUser("u1", "+15551230001"),
+					{ID: "u1", Name: "Copy", Email: "U1@example.com", PhoneNumber: "+15551230001"},
+				},
+				Numbers: []CanonicalNumber{
+					validNumber("n1", "+15551230001"),
+					validNumber("n1", "+15551230001"),
+				},
+			},
+			want: []string{
+				"error duplicate_id user u1",
+				"warning duplicate_email user u1",
+				"warning duplicate_phone_number user u1",
+				"error duplicate_id number n1",
+				"error duplicate_phone_number number n1",
+			},
+		},
+		{
+			name: "inventory mismatches",
+			system: CanonicalPhoneSystem{
+				Users: []CanonicalUser{validUser("u1", "+15551230001")},
+				Numbers: []CanonicalNumber{
+					{ID: "n2", Number: "+15551230002", Capabilities: map[string]bool{"voice": false}},
+					{ID: "n3", Number: "15551230003"},
+				},
+			},
+			want: []string{
+				"warning no_matching_number user u1",
+				"warning orphan_number number n2",
+				"info no_capabilities number n2",
+				"error invalid_e164 number n3",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := validateCanonical("Twilio", &tt.system)
+			var got []string
+			for _, finding := range report.Findings {
+				got = append(got, finding.Severity+" "+finding.Code+" "+finding.Kind+" "+finding.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings = %q, want %q", got, tt.want)
+			}
+
+			errors := 0
+			for _, finding := range tt.want {
+				if strings.HasPrefix(finding, severityError+" ") {
+					errors++
+				}
+			}
+			if report.Errors != errors || report.HasErrors() != (errors > 0) {
+				t.Errorf("Errors = %d, want %d", report.Errors, errors)
+			}
+		})
+	}
+}
+
+func TestValidateSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		data     string
+		errors   int
+		warnings int
+		wantErr  bool
+	}{
+		{
+			name:   "twilio unknown status",
+			format: "Twilio",
+			data: `{"users": [{"account_sid": "AC1", "friendly_name": "John", "email": "john@example.com", "phone_number": "+15551230001", "status": "suspended"}],
+				"phone_numbers": [{"sid": "PN1", "phone_number": "+15551230001", "capabilities": {"voice": true}}]}`,
+			warnings: 1,
+		},
+		{
+			name:   "ringcentral",
+			format: "RingCentral",
+			data: `{"accounts": [{"id": "1", "name": "Jane", "contact": "not-an-email", "main_number": "+15551230001", "active": true}],
+				"numbers": [{"id": "N1", "phone_number": "+15551230001", "features": ["voice"]}]}`,
+			errors: 1,
+		},
+		{
+			name:    "unknown format",
+			format:  "Teams",
+			data:    `{}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON",
+			format:  "Twilio",
+			data:    `{"users": [`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := ValidateSource(tt.format, []byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ValidateSource succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Errors != tt.errors || report.Warnings != tt.warnings {
+				t.Errorf("report = %s, want %d error(s), %d warning(s)", report.Summary(), tt.errors, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestValidEmail(t *testing.T) {
+	tests := map[string]bool{
+		"john@example.com":            true,
+		"john.doe+tag@example.co.uk":  true,
+		"john":                        false,
+		"John <john@example.com>":     false,
+		"john@example.com extra text": false,
+	}
+	for email, want := range tests {
+		if got := validEmail(email); got != want {
+			t.Errorf("validEmail(%q) = %t, want %t", email, got, want)
+		}
+	}
+}
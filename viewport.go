@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Lines taken by the title above every screen
+const headerHeight = 2
+
+// newViewport scrolls with the arrow and paging keys only, so letters stay
+// free for the commands of each screen.
+func newViewport() viewport.Model {
+	vp := viewport.New(0, 0)
+	vp.KeyMap = viewport.KeyMap{
+		PageDown:     key.NewBinding(key.WithKeys("pgdown")),
+		PageUp:       key.NewBinding(key.WithKeys("pgup")),
+		HalfPageUp:   key.NewBinding(key.WithKeys("ctrl+u")),
+		HalfPageDown: key.NewBinding(key.WithKeys("ctrl+d")),
+		Up:           key.NewBinding(key.WithKeys("up")),
+		Down:         key.NewBinding(key.WithKeys("down")),
+	}
+	return vp
+}
+
+// scrolling reports whether the current screen shows its content in the
+// viewport.
+func (m model) scrolling() bool {
+	switch m.state {
+	case confirmingPlan, executingPlan, completed:
+		return m.height > 0
+	}
+	return false
+}
+
+// Update sizes the viewport, scrolls it and hands every other message to
+// update, refreshing the viewport content afterwards.
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.textInput.Width = msg.Width - 4
+		m.filepicker.Height = msg.Height - sourcePickerChrome
+		if m.filepicker.Height < 3 {
+			m.filepicker.Height = 3
+		}
+		return m.syncViewport(), nil
+
+	case tea.MouseMsg:
+		if !m.scrolling() {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+
+	case tea.KeyMsg:
+		if m.scrolling() && !m.chatting && !m.skipping {
+			switch {
+			case msg.String() == "home":
+				m.viewport.GotoTop()
+				return m, nil
+			case msg.String() == "end":
+				m.viewport.GotoBottom()
+				return m, nil
+			case key.Matches(msg, m.viewport.KeyMap.Up, m.viewport.KeyMap.Down,
+				m.viewport.KeyMap.PageUp, m.viewport.KeyMap.PageDown,
+				m.viewport.KeyMap.HalfPageUp, m.viewport.KeyMap.HalfPageDown):
+				var cmd tea.Cmd
+				m.viewport, cmd = m.viewport.Update(msg)
+				return m, cmd
+			}
+		}
+	}
+
+	updated, cmd := m.update(msg)
+	return updated.(model).syncViewport(), cmd
+}
+
+// syncViewport renders the scrollable content of the current screen into
+// the viewport, wrapped to the window width. A new screen starts at the
+// top; the step list keeps following the running step unless the user
+// scrolled up.
+func (m model) syncViewport() model {
+	if !m.scrolling() {
+		return m
+	}
+
+	follow := m.state == executingPlan && (m.viewportState != executingPlan || m.viewport.AtBottom())
+	m.viewport.Width = m.width
+	m.viewport.Height = m.height - headerHeight - lipgloss.Height(m.footerView())
+	if m.viewport.Height < 1 {
+		m.viewport.Height = 1
+	}
+	m.viewport.SetContent(lipgloss.NewStyle().Width(m.width).Render(m.scrollContent()))
+
+	if follow {
+		m.viewport.GotoBottom()
+	} else if m.viewportState != m.state {
+		m.viewport.GotoTop()
+	}
+	m.viewportState = m.state
+	return m
+}
+
+// scrollContent is the part of the current screen that scrolls.
+func (m model) scrollContent() string {
+	switch m.state {
+	case confirmingPlan:
+		return m.planView()
+	case executingPlan:
+		header := aiStyle.Render("🚀 Executing Migration Plan") + "\n\n"
+		if m.resumedFrom != "" {
+			header += helpStyle.Render("Resumed from the checkpoint saved at "+m.resumedFrom) + "\n\n"
+		}
+		return header + m.stepsView()
+	case completed:
+		return m.reportView()
+	}
+	return ""
+}
+
+// footerView stays below the scrolling content.
+func (m model) footerView() string {
+	scroll := ""
+	if m.viewport.TotalLineCount() > m.viewport.Height {
+		scroll = " • ↑/↓ PgUp/PgDn or mouse wheel to scroll"
+	}
+
+	switch m.state {
+	case confirmingPlan:
+		footer := ""
+		if m.chatting || len(m.chatLog) > 0 {
+			footer = m.planChatView()
+		}
+		if m.chatting {
+			return footer
+		}
+		if m.canRefinePlan() {
+			footer += successStyle.Render("Do you want to proceed with this plan? (Y/n, e to edit, c to chat with Engine Room AI)")
+		} else {
+			footer += successStyle.Render("Do you want to proceed with this plan? (Y/n, e to edit)")
+		}
+		approval := "off"
+		if m.config.ApproveHighRisk {
+			approval = "on"
+		}
+		return footer + "\n" + helpStyle.Render(fmt.Sprintf("h to toggle approval before high-risk steps (%s) • q to quit%s", approval, scroll))
+	case executingPlan:
+		if m.skipping {
+			return m.stepControlView()
+		}
+		footer := m.stepControlView()
+		if m.checkpointErr != nil {
+			footer += errorStyle.Render(fmt.Sprintf("⚠ Progress is not being saved: %v", m.checkpointErr)) + "\n"
+			return footer + helpStyle.Render("q to quit"+scroll)
+		}
+		return footer + helpStyle.Render(fmt.Sprintf("q to quit, progress is saved to %s (continue with: phone-migration-tool resume)%s", m.checkpointFile, scroll))
+	case completed:
+		switch {
+		case m.rollingBack:
+			return m.spinner.View() + " Rolling back the migration...\n" + helpStyle.Render("Press q or Enter to exit"+scroll)
+		case m.migrationDone && !m.migrationUndone:
+			return helpStyle.Render("Press q or Enter to exit, u to roll back this migration" + scroll)
+		}
+		return helpStyle.Render("Press q or Enter to exit" + scroll)
+	}
+	return ""
+}
+
+// scrollableView shows the content in the viewport once the window size is
+// known, and in full before that.
+func (m model) scrollableView() string {
+	if !m.scrolling() {
+		return m.scrollContent() + "\n" + m.footerView()
+	}
+	return m.viewport.View() + "\n" + m.footerView()
+}
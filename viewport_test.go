@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// executingModel is a model part way through a long step list.
+func executingModel(steps int) model {
+	m := initialModel()
+	m.state = executingPlan
+	for i := 0; i < steps; i++ {
+		m.executionSteps = append(m.executionSteps, ExecutionStep{
+			StepNumber:  i + 1,
+			Description: fmt.Sprintf("Step %d", i+1),
+			Status:      "pending",
+		})
+	}
+	return m
+}
+
+func sendKey(t *testing.T, m model, key tea.KeyType) model {
+	t.Helper()
+	updated, _ := m.Update(tea.KeyMsg{Type: key})
+	return updated.(model)
+}
+
+func TestViewportFollowsRunningStep(t *testing.T) {
+	updated, _ := executingModel(40).Update(tea.WindowSizeMsg{Width: 80, Height: 20})
+	m := updated.(model)
+
+	if m.viewport.Height != 20-headerHeight-1 || m.viewport.Width != 80 {
+		t.Fatalf("viewport is %dx%d", m.viewport.Width, m.viewport.Height)
+	}
+	if !m.viewport.AtBottom() {
+		t.Fatal("step list does not start at the running step")
+	}
+
+	// Scrolling up stops following, even as steps complete
+	m = sendKey(t, m, tea.KeyPgUp)
+	offset := m.viewport.YOffset
+	m.executionSteps[0].Status = "completed"
+	m = m.syncViewport()
+	if m.viewport.AtBottom() || m.viewport.YOffset != offset {
+		t.Errorf("viewport moved from %d to %d after the user scrolled up", offset, m.viewport.YOffset)
+	}
+
+	m = sendKey(t, m, tea.KeyEnd)
+	m.executionSteps = append(m.executionSteps, ExecutionStep{StepNumber: 41, Description: "Step 41", Status: "running"})
+	m = m.syncViewport()
+	if !m.viewport.AtBottom() {
+		t.Error("viewport stopped following after scrolling back to the end")
+	}
+}
+
+func TestViewportStartsNewScreenAtTop(t *testing.T) {
+	updated, _ := executingModel(40).Update(tea.WindowSizeMsg{Width: 80, Height: 20})
+	m := updated.(model)
+
+	m.state = completed
+	m = m.syncViewport()
+	if m.viewport.YOffset != 0 {
+		t.Errorf("completed screen opened at offset %d", m.viewport.YOffset)
+	}
+}
+
+func TestViewportNotUsedBeforeWindowSize(t *testing.T) {
+	m := executingModel(3)
+	if m.scrolling() {
+		t.Fatal("scrolling before the window size is known")
+	}
+	if view := m.scrollableView(); view == "" {
+		t.Error("nothing rendered before the window size is known")
+	}
+}